@@ -0,0 +1,236 @@
+package gormkeyvalue
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrAllEntriesFailed = errors.New("no entry was saved")
+	ErrInvalidBatchSize = errors.New("batch size must be greater than zero")
+)
+
+const maxInClauseSize = 1000
+
+func chunkSlice[T any](items []T, size int) [][]T {
+	chunks := [][]T{}
+	for start := 0; start < len(items); start += size {
+		end := start + size
+		if end > len(items) {
+			end = len(items)
+		}
+		chunks = append(chunks, items[start:end])
+	}
+	return chunks
+}
+
+func (db *dbHandler) DeleteEntriesByIDs(ids []uint64) (int64, error) {
+	var deleted int64
+	for _, chunk := range chunkSlice(ids, maxInClauseSize) {
+		n, err := db.deleteEntries(func(tx *gorm.DB) *gorm.DB {
+			return tx.Where("id IN ?", chunk)
+		})
+		if err != nil {
+			return deleted, fmt.Errorf("delete entries by ids: %w", err)
+		}
+		deleted += n
+	}
+	return deleted, nil
+}
+
+func (db *dbHandler) TouchEntries(keys []string) (int64, error) {
+	now := db.gorm.NowFunc()
+
+	var touched int64
+	for _, chunk := range chunkSlice(keys, maxInClauseSize) {
+		result := db.gorm.Model(&Entry{}).Where("`key` IN ?", chunk).UpdateColumn("updated_at", now)
+		if result.Error != nil {
+			return touched, fmt.Errorf("touch entries: %w", result.Error)
+		}
+		touched += result.RowsAffected
+	}
+
+	if touched > 0 {
+		db.fireSaved(keys...)
+	}
+	return touched, nil
+}
+
+// GetEntriesByKeysConcurrent reads the keys in chunks of chunkSize, running up to
+// concurrency IN queries at once. Concurrency is capped one below the pool's
+// max open connections so the reads don't starve the rest of the pool. Missing keys are omitted
+func (db *dbHandler) GetEntriesByKeysConcurrent(keys []string, chunkSize, concurrency int) (map[string]Entry, error) {
+	if chunkSize <= 0 {
+		return nil, ErrInvalidBatchSize
+	}
+	concurrency = db.capReadConcurrency(concurrency)
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+		result   = make(map[string]Entry, len(keys))
+		sem      = make(chan struct{}, concurrency)
+	)
+	for _, chunk := range chunkSlice(keys, chunkSize) {
+		chunk := chunk
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			entrys := []Entry{}
+			err := db.gorm.Where("`key` IN ?", chunk).Find(&entrys).Error
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			for _, e := range entrys {
+				result[e.Key] = e
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, fmt.Errorf("get entries by keys concurrent: %w", firstErr)
+	}
+	return result, nil
+}
+
+// GetEntriesByKeysOrdered returns the entries in the order of keys. A missing key
+// is skipped, or with placeholders becomes an Entry with only Key set,
+// so the result lines up with keys index by index
+func (db *dbHandler) GetEntriesByKeysOrdered(keys []string, placeholders bool) ([]Entry, error) {
+	found, err := db.GetEntriesByKeysConcurrent(keys, maxInClauseSize, 1)
+	if err != nil {
+		return nil, fmt.Errorf("get entries by keys ordered: %w", err)
+	}
+
+	entrys := make([]Entry, 0, len(keys))
+	for _, key := range keys {
+		e, ok := found[key]
+		if !ok {
+			if !placeholders {
+				continue
+			}
+			e = Entry{Key: key}
+		}
+		entrys = append(entrys, e)
+	}
+	return entrys, nil
+}
+
+// SaveEntries upserts the entries by key in a single statement
+func (db *dbHandler) SaveEntries(entries []Entry) error {
+	if err := db.saveEntriesInBatches(entries, len(entries)); err != nil {
+		return fmt.Errorf("save entries: %w", err)
+	}
+	return nil
+}
+
+// capReadConcurrency keeps a connection of the pool free for other queries. It reads
+// the pool itself, which for NewWithDB is configured by the caller rather than cfg
+func (db *dbHandler) capReadConcurrency(concurrency int) int {
+	if maxOpen := db.conn.Stats().MaxOpenConnections; maxOpen > 0 && concurrency > maxOpen-1 {
+		concurrency = maxOpen - 1
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return concurrency
+}
+
+// SaveEntriesBatched upserts the entries by key, batchSize rows per statement.
+// Keep batches of big values small enough for max_allowed_packet
+func (db *dbHandler) SaveEntriesBatched(entries []Entry, batchSize int) error {
+	if batchSize <= 0 {
+		return ErrInvalidBatchSize
+	}
+
+	if err := db.saveEntriesInBatches(entries, batchSize); err != nil {
+		return fmt.Errorf("save entries batched: %w", err)
+	}
+	return nil
+}
+
+func (db *dbHandler) saveEntriesInBatches(entries []Entry, batchSize int) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	for _, e := range entries {
+		if err := db.validator.validate(e.Value); err != nil {
+			return fmt.Errorf("entry %q: %w", e.Key, err)
+		}
+		if err := db.validateName(e.Name); err != nil {
+			return fmt.Errorf("entry %q: %w", e.Key, err)
+		}
+	}
+
+	// entries are matched by key, see SaveEntry
+	saved := make([]Entry, len(entries))
+	for i, e := range entries {
+		e.ID = 0
+		saved[i] = e
+	}
+
+	err := db.withWriteRetry(func() error {
+		if db.cfg.UniqueName {
+			// see upsertOnKey, a batch upsert could overwrite entries owning the names
+			return db.gorm.Transaction(func(tx *gorm.DB) error {
+				for i := range saved {
+					if err := db.upsertEntry(tx, &saved[i]); err != nil {
+						return fmt.Errorf("entry %q: %w", saved[i].Key, err)
+					}
+				}
+				return nil
+			})
+		}
+
+		return db.gorm.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "key"}},
+			DoUpdates: clause.AssignmentColumns([]string{"name", "value", "updated_at"}),
+		}).CreateInBatches(&saved, batchSize).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, e := range saved {
+		db.hooks.fireAfterSave(e)
+	}
+	return nil
+}
+
+// SaveEntriesPartial saves entries one by one and reports failures by their index
+// instead of aborting. err is only set when not a single entry was saved
+func (db *dbHandler) SaveEntriesPartial(entries []Entry) (int64, map[int]error, error) {
+	var okCount int64
+	failures := map[int]error{}
+	for i, e := range entries {
+		if err := db.SaveEntry(e); err != nil {
+			failures[i] = err
+			continue
+		}
+		okCount++
+	}
+
+	if len(entries) > 0 && okCount == 0 {
+		return 0, failures, ErrAllEntriesFailed
+	}
+	return okCount, failures, nil
+}
@@ -0,0 +1,30 @@
+package gormkeyvalue
+
+import "testing"
+
+func TestCapReadConcurrency(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxOpen     int
+		concurrency int
+		want        int
+	}{
+		{"unlimited pool", 0, 50, 50},
+		{"below the pool", 10, 4, 4},
+		{"leaves a connection free", 10, 10, 9},
+		{"above the pool", 10, 50, 9},
+		{"single connection pool", 1, 5, 1},
+		{"not positive", 10, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := NewWithRecorder()
+			db := m.(*dbHandler)
+			db.conn.SetMaxOpenConns(tt.maxOpen)
+
+			if got := db.capReadConcurrency(tt.concurrency); got != tt.want {
+				t.Errorf("capReadConcurrency(%d) = %d, want %d", tt.concurrency, got, tt.want)
+			}
+		})
+	}
+}
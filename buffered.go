@@ -0,0 +1,184 @@
+package gormkeyvalue
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrWriterClosed         = errors.New("buffered writer is closed")
+	ErrInvalidFlushInterval = errors.New("flush interval must be greater than zero")
+)
+
+// permanentWriteErrs fail an entry however often it is retried
+var permanentWriteErrs = []error{ErrNameTooLong, ErrNameTaken, ErrSchemaValidation, ErrInvalidJSON}
+
+// BufferedWriter collects entries in memory and saves them with SaveEntries once
+// maxSize entries are pending or every flushInterval. Writes are at-least-once:
+// a failed batch is kept and retried on the next flush. Entries still buffered
+// when the process crashes are lost, so the durability window is flushInterval
+// (or maxSize entries). Only the last write of a key within a window is saved.
+// Entries that can never be saved, e.g. with ErrNameTooLong, are dropped by the
+// flush that reports them instead of being retried
+type BufferedWriter struct {
+	memory  Memory
+	maxSize int
+
+	flushMu sync.Mutex
+
+	mu      sync.Mutex
+	pending []Entry
+	index   map[string]int
+	closed  bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewBufferedWriter(m Memory, maxSize int, flushInterval time.Duration) (*BufferedWriter, error) {
+	if maxSize <= 0 {
+		return nil, ErrInvalidBatchSize
+	}
+	if flushInterval <= 0 {
+		return nil, ErrInvalidFlushInterval
+	}
+
+	w := &BufferedWriter{
+		memory:  m,
+		maxSize: maxSize,
+		index:   map[string]int{},
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	go w.flushPeriodically(flushInterval)
+	return w, nil
+}
+
+func (w *BufferedWriter) flushPeriodically(interval time.Duration) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			// a failed batch stays buffered for the next tick
+			_ = w.Flush()
+		}
+	}
+}
+
+func (w *BufferedWriter) Save(e Entry) error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrWriterClosed
+	}
+
+	w.add(e)
+	full := len(w.pending) >= w.maxSize
+	w.mu.Unlock()
+
+	if full {
+		return w.Flush()
+	}
+	return nil
+}
+
+// add must be called with mu held
+func (w *BufferedWriter) add(e Entry) {
+	if i, found := w.index[e.Key]; found {
+		w.pending[i] = e
+		return
+	}
+
+	w.index[e.Key] = len(w.pending)
+	w.pending = append(w.pending, e)
+}
+
+func (w *BufferedWriter) Flush() error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	batch := w.pending
+	w.pending = nil
+	w.index = map[string]int{}
+	w.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	err := w.memory.SaveEntries(batch)
+	if err == nil {
+		return nil
+	}
+	if !isPermanentWriteErr(err) {
+		w.requeue(batch)
+		return fmt.Errorf("flush buffered entries: %w", err)
+	}
+
+	// one invalid entry fails the whole batch: save the others one by one
+	// and drop the invalid ones, which would fail every retry
+	_, failures, _ := w.memory.SaveEntriesPartial(batch)
+	retry := []Entry{}
+	dropped := 0
+	for i, e := range batch {
+		failure, failed := failures[i]
+		if !failed {
+			continue
+		}
+		if isPermanentWriteErr(failure) {
+			dropped++
+			err = failure
+			continue
+		}
+		retry = append(retry, e)
+	}
+	w.requeue(retry)
+
+	return fmt.Errorf("flush buffered entries: dropped %d invalid, %d kept for retry: %w", dropped, len(retry), err)
+}
+
+func isPermanentWriteErr(err error) bool {
+	for _, permanent := range permanentWriteErrs {
+		if errors.Is(err, permanent) {
+			return true
+		}
+	}
+	return false
+}
+
+// requeue returns a failed batch to the buffer without overwriting newer writes
+func (w *BufferedWriter) requeue(batch []Entry) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, e := range batch {
+		if _, found := w.index[e.Key]; !found {
+			w.add(e)
+		}
+	}
+}
+
+// Close stops the periodic flush and drains the buffer
+func (w *BufferedWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	close(w.stop)
+	<-w.done
+	return w.Flush()
+}
@@ -0,0 +1,398 @@
+package gormkeyvalue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ChainWriteMode int
+
+const (
+	// ChainWriteBoth writes to the secondary and then to the primary
+	ChainWriteBoth ChainWriteMode = iota
+	// ChainWriteSecondary writes to the secondary only
+	ChainWriteSecondary
+)
+
+// Chain is a tiered store: a fast primary in front of a slower secondary.
+// Reads not overridden here are served by the secondary. Every write goes to the
+// secondary, then the primary copy is rewritten (ChainWriteBoth, SaveEntry only)
+// or dropped, so the primary never serves a stale entry
+type Chain struct {
+	Memory
+
+	primary         Memory
+	populatePrimary bool
+	writeMode       ChainWriteMode
+}
+
+func NewChain(primary, secondary Memory, populatePrimary bool, writeMode ChainWriteMode) *Chain {
+	return &Chain{
+		Memory:          secondary,
+		primary:         primary,
+		populatePrimary: populatePrimary,
+		writeMode:       writeMode,
+	}
+}
+
+type Source string
+
+const (
+	SourcePrimary   Source = "primary"
+	SourceSecondary Source = "secondary"
+	SourceMiss      Source = "miss"
+)
+
+func (c *Chain) GetEntry(key string) (Entry, error) {
+	e, _, err := c.GetEntrySourced(key)
+	return e, err
+}
+
+// GetEntrySourced works like GetEntry and also reports which tier served the entry
+func (c *Chain) GetEntrySourced(key string) (Entry, Source, error) {
+	e, err := c.primary.GetEntry(key)
+	if err == nil {
+		return e, SourcePrimary, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return Entry{}, SourceMiss, fmt.Errorf("get entry from primary: %w", err)
+	}
+
+	e, err = c.Memory.GetEntry(key)
+	if err != nil {
+		return Entry{}, SourceMiss, err
+	}
+
+	if c.populatePrimary {
+		// a failed read-through only costs the next read another miss
+		_ = c.primary.SaveEntry(copyForPrimary(e))
+	}
+	return e, SourceSecondary, nil
+}
+
+func (c *Chain) SaveEntry(e Entry) error {
+	if err := c.Memory.SaveEntry(e); err != nil {
+		return err
+	}
+	return c.afterSave(e)
+}
+
+func (c *Chain) SaveKV(key string, value []byte) error {
+	return c.SaveEntry(Entry{Key: key, Name: key, Value: value})
+}
+
+func (c *Chain) SaveAndGet(e Entry) (Entry, error) {
+	stored, err := c.Memory.SaveAndGet(e)
+	if err != nil {
+		return Entry{}, err
+	}
+	return stored, c.afterSave(stored)
+}
+
+func (c *Chain) SaveEntries(entries []Entry) error {
+	if err := c.Memory.SaveEntries(entries); err != nil {
+		return err
+	}
+	return c.afterSaveAll(entries)
+}
+
+func (c *Chain) SaveEntriesBatched(entries []Entry, batchSize int) error {
+	if err := c.Memory.SaveEntriesBatched(entries, batchSize); err != nil {
+		return err
+	}
+	return c.afterSaveAll(entries)
+}
+
+func (c *Chain) SaveEntriesPartial(entries []Entry) (int64, map[int]error, error) {
+	okCount, failures, err := c.Memory.SaveEntriesPartial(entries)
+	if err != nil {
+		return okCount, failures, err
+	}
+
+	saved := make([]Entry, 0, okCount)
+	for i, e := range entries {
+		if _, failed := failures[i]; !failed {
+			saved = append(saved, e)
+		}
+	}
+	return okCount, failures, c.afterSaveAll(saved)
+}
+
+func (c *Chain) SaveEntryMerge(e Entry) error {
+	if err := c.Memory.SaveEntryMerge(e); err != nil {
+		return err
+	}
+	return c.invalidatePrimary(e.Key)
+}
+
+func (c *Chain) SetValueIfUnchanged(key string, expectedOldValue, newValue []byte) (bool, error) {
+	swapped, err := c.Memory.SetValueIfUnchanged(key, expectedOldValue, newValue)
+	if err != nil || !swapped {
+		return swapped, err
+	}
+	return true, c.invalidatePrimary(key)
+}
+
+func (c *Chain) SaveEntryIfAbsent(e Entry) (bool, error) {
+	created, err := c.Memory.SaveEntryIfAbsent(e)
+	if err != nil || !created {
+		return created, err
+	}
+	return true, c.invalidatePrimary(e.Key)
+}
+
+func (c *Chain) ClaimKey(key string, value []byte) (bool, error) {
+	claimed, err := c.Memory.ClaimKey(key, value)
+	if err != nil || !claimed {
+		return claimed, err
+	}
+	return true, c.invalidatePrimary(key)
+}
+
+func (c *Chain) GetOrGenerate(key string, gen func() ([]byte, error)) (Entry, error) {
+	e, err := c.GetEntry(key)
+	if err == nil {
+		return e, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return Entry{}, err
+	}
+
+	e, err = c.Memory.GetOrGenerate(key, gen)
+	if err != nil {
+		return Entry{}, err
+	}
+	return e, c.invalidatePrimary(key)
+}
+
+func (c *Chain) InsertEntry(e *Entry) error {
+	if err := c.Memory.InsertEntry(e); err != nil {
+		return err
+	}
+	return c.invalidatePrimary(e.Key)
+}
+
+func (c *Chain) ImportEntries(entries []Entry, policy ConflictPolicy) error {
+	err := c.Memory.ImportEntries(entries, policy)
+
+	// earlier batches may be imported even when it fails
+	keys := make([]string, len(entries))
+	for i, e := range entries {
+		keys[i] = e.Key
+	}
+	if invalidateErr := c.invalidatePrimary(keys...); err == nil {
+		err = invalidateErr
+	}
+	return err
+}
+
+func (c *Chain) Restore(ctx context.Context, r io.Reader) error {
+	err := c.Memory.Restore(ctx, r)
+	if clearErr := c.clearPrimary(); err == nil {
+		err = clearErr
+	}
+	return err
+}
+
+func (c *Chain) MergePatchValue(key string, patch []byte) error {
+	if err := c.Memory.MergePatchValue(key, patch); err != nil {
+		return err
+	}
+	return c.invalidatePrimary(key)
+}
+
+func (c *Chain) AppendToJSONArray(key string, element []byte) error {
+	if err := c.Memory.AppendToJSONArray(key, element); err != nil {
+		return err
+	}
+	return c.invalidatePrimary(key)
+}
+
+func (c *Chain) IncrementEntry(key string, delta int64) (int64, error) {
+	n, err := c.Memory.IncrementEntry(key, delta)
+	if err != nil {
+		return 0, err
+	}
+	return n, c.invalidatePrimary(key)
+}
+
+func (c *Chain) SetTimestamps(key string, createdAt, updatedAt time.Time) error {
+	if err := c.Memory.SetTimestamps(key, createdAt, updatedAt); err != nil {
+		return err
+	}
+	return c.invalidatePrimary(key)
+}
+
+func (c *Chain) AddTag(key, tag string) error {
+	if err := c.Memory.AddTag(key, tag); err != nil {
+		return err
+	}
+	return c.invalidatePrimary(key)
+}
+
+func (c *Chain) RemoveTag(key, tag string) error {
+	if err := c.Memory.RemoveTag(key, tag); err != nil {
+		return err
+	}
+	return c.invalidatePrimary(key)
+}
+
+func (c *Chain) TouchEntries(keys []string) (int64, error) {
+	touched, err := c.Memory.TouchEntries(keys)
+	if err != nil {
+		return touched, err
+	}
+	return touched, c.invalidatePrimary(keys...)
+}
+
+func (c *Chain) PopEntry(key string) (Entry, error) {
+	e, err := c.Memory.PopEntry(key)
+	if invalidateErr := c.invalidatePrimary(key); err == nil {
+		err = invalidateErr
+	}
+	return e, err
+}
+
+func (c *Chain) PopAnyByNamePrefix(prefix string) (Entry, bool, error) {
+	e, ok, err := c.Memory.PopAnyByNamePrefix(prefix)
+	if err != nil || !ok {
+		return e, ok, err
+	}
+	return e, true, c.invalidatePrimary(e.Key)
+}
+
+func (c *Chain) Lock(key string, ttl time.Duration) (func() error, bool, error) {
+	unlock, acquired, err := c.Memory.Lock(key, ttl)
+	if err != nil || !acquired {
+		return unlock, acquired, err
+	}
+
+	lockKey := NamespaceKey(lockNamespace, key)
+	if err := c.invalidatePrimary(lockKey); err != nil {
+		return unlock, true, err
+	}
+	return func() error {
+		if err := unlock(); err != nil {
+			return err
+		}
+		return c.invalidatePrimary(lockKey)
+	}, true, nil
+}
+
+func (c *Chain) PurgeExpiredLocks() (int64, error) {
+	purged, err := c.Memory.PurgeExpiredLocks()
+	if err != nil || purged == 0 {
+		return purged, err
+	}
+	if _, err := c.primary.DeleteNamespace(lockNamespace); err != nil {
+		return purged, fmt.Errorf("purge expired locks from primary: %w", err)
+	}
+	return purged, nil
+}
+
+func (c *Chain) DeleteNamespace(ns string) (int64, error) {
+	deleted, err := c.Memory.DeleteNamespace(ns)
+	if err != nil {
+		return deleted, err
+	}
+	if _, err := c.primary.DeleteNamespace(ns); err != nil {
+		return deleted, fmt.Errorf("delete namespace from primary: %w", err)
+	}
+	return deleted, nil
+}
+
+func (c *Chain) DeleteEntriesByIDs(ids []uint64) (int64, error) {
+	deleted, err := c.Memory.DeleteEntriesByIDs(ids)
+	return deleted, c.clearPrimaryAfter(deleted, err)
+}
+
+func (c *Chain) DeleteEntriesOlderThan(t time.Time, column TimestampColumn) (int64, error) {
+	deleted, err := c.Memory.DeleteEntriesOlderThan(t, column)
+	return deleted, c.clearPrimaryAfter(deleted, err)
+}
+
+func (c *Chain) DedupeKeys(keep string) (int64, error) {
+	deleted, err := c.Memory.DedupeKeys(keep)
+	return deleted, c.clearPrimaryAfter(deleted, err)
+}
+
+func (c *Chain) RekeyPrefix(oldPrefix, newPrefix string) (int64, error) {
+	renamed, err := c.Memory.RekeyPrefix(oldPrefix, newPrefix)
+	return renamed, c.clearPrimaryAfter(renamed, err)
+}
+
+// afterSave writes e to the primary too with ChainWriteBoth, otherwise it drops
+// the primary copy the write made stale
+func (c *Chain) afterSave(e Entry) error {
+	if c.writeMode != ChainWriteBoth {
+		return c.invalidatePrimary(e.Key)
+	}
+
+	if err := c.primary.SaveEntry(copyForPrimary(e)); err != nil {
+		return fmt.Errorf("save entry to primary: %w", err)
+	}
+	return nil
+}
+
+func (c *Chain) afterSaveAll(entries []Entry) error {
+	if c.writeMode != ChainWriteBoth {
+		keys := make([]string, len(entries))
+		for i, e := range entries {
+			keys[i] = e.Key
+		}
+		return c.invalidatePrimary(keys...)
+	}
+
+	copies := make([]Entry, len(entries))
+	for i, e := range entries {
+		copies[i] = copyForPrimary(e)
+	}
+	if err := c.primary.SaveEntries(copies); err != nil {
+		return fmt.Errorf("save entries to primary: %w", err)
+	}
+	return nil
+}
+
+// invalidatePrimary drops the primary copies of keys, the next read
+// goes to the secondary
+func (c *Chain) invalidatePrimary(keys ...string) error {
+	for _, key := range keys {
+		_, err := c.primary.PopEntry(key)
+		if err != nil && !errors.Is(err, ErrEntryNotFound) {
+			return fmt.Errorf("invalidate primary: %w", err)
+		}
+	}
+	return nil
+}
+
+// clearPrimaryAfter clears the primary after a write to the secondary
+// whose keys aren't known, unless it changed nothing
+func (c *Chain) clearPrimaryAfter(changed int64, err error) error {
+	if changed == 0 {
+		return err
+	}
+	if clearErr := c.clearPrimary(); err == nil {
+		err = clearErr
+	}
+	return err
+}
+
+// clearPrimary deletes every primary copy: all of them were created before the end of time
+func (c *Chain) clearPrimary() error {
+	endOfTime := time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC)
+	if _, err := c.primary.DeleteEntriesOlderThan(endOfTime, CreatedAtColumn); err != nil {
+		return fmt.Errorf("clear primary: %w", err)
+	}
+	return nil
+}
+
+// copyForPrimary drops the secondary's surrogate id, the primary upserts by key
+func copyForPrimary(e Entry) Entry {
+	e.ID = 0
+	return e
+}
@@ -0,0 +1,132 @@
+package gormkeyvalue
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"gorm.io/gorm/schema"
+)
+
+// DBConfigFromEnv loads the config from the DB_* environment variables named in the
+// envconfig tags, applying the declared defaults. Every required variable that is
+// not set is listed in the error
+func DBConfigFromEnv() (DBConfig, error) {
+	missing := []string{}
+	t := reflect.TypeOf(DBConfig{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Tag.Get("required") != "true" {
+			continue
+		}
+
+		name := field.Tag.Get("envconfig")
+		if _, ok := os.LookupEnv(name); !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return DBConfig{}, fmt.Errorf("missing required environment variables: %s", strings.Join(missing, ", "))
+	}
+
+	var cfg DBConfig
+	if err := envconfig.Process("", &cfg); err != nil {
+		return DBConfig{}, fmt.Errorf("load config from env: %w", err)
+	}
+	return cfg, nil
+}
+
+// Validate reports every setting that can't work, so New fails fast
+// instead of with a driver error later
+func (cfg DBConfig) Validate() error {
+	errs := []error{}
+	if cfg.Port < 1 || cfg.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port %d is out of range 1-65535", cfg.Port))
+	}
+	if cfg.Name == "" {
+		errs = append(errs, errors.New("database name is empty"))
+	}
+	if cfg.User == "" {
+		errs = append(errs, errors.New("database user is empty"))
+	}
+	if cfg.ConnTimeoutMS < 0 {
+		errs = append(errs, fmt.Errorf("conn timeout %dms is negative", cfg.ConnTimeoutMS))
+	}
+	if cfg.SyncSafetyWindowMS < 0 {
+		errs = append(errs, fmt.Errorf("sync safety window %dms is negative", cfg.SyncSafetyWindowMS))
+	}
+	if cfg.MaxOpenConns < 0 {
+		errs = append(errs, fmt.Errorf("max open conns %d is negative", cfg.MaxOpenConns))
+	}
+	if cfg.MaxIdleConns < 0 {
+		errs = append(errs, fmt.Errorf("max idle conns %d is negative", cfg.MaxIdleConns))
+	}
+	if cfg.MaxOpenConns > 0 && cfg.MaxIdleConns > cfg.MaxOpenConns {
+		errs = append(errs, fmt.Errorf(
+			"max idle conns %d exceeds max open conns %d", cfg.MaxIdleConns, cfg.MaxOpenConns,
+		))
+	}
+	errs = append(errs, cfg.storeSettingErrors()...)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid db config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// validateStoreSettings is Validate without the connection settings,
+// which NewWithDB ignores
+func (cfg DBConfig) validateStoreSettings() error {
+	if errs := cfg.storeSettingErrors(); len(errs) > 0 {
+		return fmt.Errorf("invalid db config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func (cfg DBConfig) storeSettingErrors() []error {
+	errs := []error{}
+	if _, err := time.LoadLocation(cfg.Location); err != nil {
+		errs = append(errs, fmt.Errorf("location %q: %w", cfg.Location, err))
+	}
+	if _, err := getValueColumnType(cfg); err != nil {
+		errs = append(errs, err)
+	}
+	if err := cfg.MigrationMode.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateNameReplacer(cfg.NameReplacer); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateTableOptions(cfg); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// validateNameReplacer rejects a replacer that renames an Entry column:
+// raw conditions in this package use the default column names
+func validateNameReplacer(replacer schema.Replacer) error {
+	if replacer == nil {
+		return nil
+	}
+
+	entrySchema, err := schema.Parse(&Entry{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		return fmt.Errorf("parse entry schema: %w", err)
+	}
+	replaced := schema.NamingStrategy{NameReplacer: replacer}
+	for _, field := range entrySchema.Fields {
+		if field.DBName == "" {
+			continue
+		}
+		if name := replaced.ColumnName("", field.Name); name != field.DBName {
+			return fmt.Errorf("name replacer renames column %s to %s", field.DBName, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package gormkeyvalue
+
+import (
+	"database/sql"
+	"strings"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm/schema"
+)
+
+func TestValidateNameReplacer(t *testing.T) {
+	tests := []struct {
+		name     string
+		replacer schema.Replacer
+		wantErr  bool
+	}{
+		{"none", nil, false},
+		// gorm replaces in the struct name before pluralizing it
+		{"table only", strings.NewReplacer("Entry", "KV"), false},
+		{"renames key", strings.NewReplacer("Key", "K"), true},
+		{"renames timestamps", strings.NewReplacer("At", "Time"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateNameReplacer(tt.replacer)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNameReplacerRenamesTable(t *testing.T) {
+	namer := schema.NamingStrategy{NameReplacer: strings.NewReplacer("Entry", "KV")}
+	if err := validateNameReplacer(namer.NameReplacer); err != nil {
+		t.Fatalf("validate name replacer: %v", err)
+	}
+
+	s, err := schema.Parse(&Entry{}, &sync.Map{}, namer)
+	if err != nil {
+		t.Fatalf("parse entry schema: %v", err)
+	}
+	if s.Table != "kvs" {
+		t.Errorf("table = %q, want kvs", s.Table)
+	}
+}
+
+func TestNewWithDBValidatesStoreSettings(t *testing.T) {
+	conn, err := sql.Open(dbDriver, "")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer conn.Close()
+
+	// connection settings are left empty, NewWithDB ignores them
+	_, err = NewWithDB(conn, DBConfig{Location: "UTC", MigrationMode: "drop_everything"})
+	if err == nil || !strings.Contains(err.Error(), "unsupported migration mode") {
+		t.Errorf("err = %v, want the unsupported migration mode", err)
+	}
+}
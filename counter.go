@@ -0,0 +1,102 @@
+package gormkeyvalue
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Counter struct {
+	memory Memory
+}
+
+func NewCounter(m Memory) *Counter {
+	return &Counter{memory: m}
+}
+
+func (c *Counter) Inc(key string) (int64, error) {
+	return c.Add(key, 1)
+}
+
+func (c *Counter) Add(key string, n int64) (int64, error) {
+	return c.memory.IncrementEntry(key, n)
+}
+
+func (c *Counter) Get(key string) (int64, error) {
+	e, err := c.memory.GetEntry(key)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("get counter: %w", err)
+	}
+	return parseCounterValue(e.Value)
+}
+
+func (c *Counter) Reset(key string) error {
+	e, err := c.memory.GetEntry(key)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("get counter: %w", err)
+	}
+
+	e.Value = formatCounterValue(0)
+	if err := c.memory.SaveEntry(e); err != nil {
+		return fmt.Errorf("reset counter: %w", err)
+	}
+	return nil
+}
+
+func formatCounterValue(n int64) []byte {
+	return []byte(strconv.FormatInt(n, 10))
+}
+
+func parseCounterValue(value []byte) (int64, error) {
+	n, err := strconv.ParseInt(strings.TrimSpace(string(value)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse counter value: %w", err)
+	}
+	return n, nil
+}
+
+// IncrementEntry adds delta to the counter stored under key, creating it when missing.
+// With a value schema set, a sum that doesn't match it is rolled back
+func (db *dbHandler) IncrementEntry(key string, delta int64) (int64, error) {
+	var result int64
+	var stored Entry
+	err := db.withWriteRetry(func() error {
+		return db.gorm.Transaction(func(tx *gorm.DB) error {
+			e := Entry{Key: key, Value: formatCounterValue(delta)}
+			err := db.upsertOnKey(tx, &e, clause.Assignments(map[string]interface{}{
+				"value":      gorm.Expr("CAST(CAST(CAST(`value` AS CHAR) AS SIGNED) + ? AS JSON)", delta),
+				"updated_at": tx.NowFunc(),
+			}))
+			if err != nil {
+				return fmt.Errorf("upsert counter: %w", err)
+			}
+
+			if err := tx.Model(&Entry{}).Where("`key` = ?", key).First(&stored).Error; err != nil {
+				return fmt.Errorf("read counter: %w", err)
+			}
+			// the sum is computed in SQL, the schema is checked before commit
+			if err := db.validator.validate(stored.Value); err != nil {
+				return err
+			}
+
+			result, err = parseCounterValue(stored.Value)
+			return err
+		})
+	})
+	if err != nil {
+		return 0, fmt.Errorf("increment entry: %w", err)
+	}
+
+	db.hooks.fireAfterSave(stored)
+	return result, nil
+}
@@ -1,15 +1,20 @@
 package gormkeyvalue
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net/url"
 	"os"
+	"reflect"
 	"time"
 
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 	"gorm.io/gorm/schema"
 )
@@ -24,11 +29,39 @@ const (
 
 var models = []interface{}{&Entry{}}
 
+var ErrEntryNotFound = errors.New("entry not found")
+
+var ErrEmptyKey = errors.New("entry key is empty")
+
+var ErrNameTooLong = errors.New("entry name is too long")
+
+var ErrNameTaken = errors.New("entry name belongs to another key")
+
+var ErrTooManyEntries = errors.New("too many entries for an unbounded fetch, use SyncSince or ExportCSV to iterate")
+
 type dbHandler struct {
-	conn *sql.DB
-	gorm *gorm.DB
+	cfg      DBConfig
+	conn     *sql.DB
+	ownsConn bool
+	gorm     *gorm.DB
+	// views share the hooks, event dispatchers and pool collector of their parent,
+	// which only the parent's Close stops
+	isView bool
+	// false when the prepared statement cache belongs to the parent of a view
+	ownsStmtCache bool
+	prefixViews   *prefixViews
 
-	tablesPrefix string
+	tablesPrefix    string
+	tableOptions    string
+	valueColumnType string
+	deadlockRetries int
+
+	skipIndexMigration bool
+
+	hooks      *entryHooks
+	queryHooks *queryHooks
+	poolWait   *poolWaitCollector
+	validator  *valueValidator
 }
 
 type DBConfig struct {
@@ -39,21 +72,184 @@ type DBConfig struct {
 	Password      string `json:"DB_PASSWORD" envconfig:"DB_PASSWORD" default:""`
 	ConnTimeoutMS int    `json:"DB_CONN_TIMEOUT" envconfig:"DB_CONN_TIMEOUT" default:"5000"`
 	TablePrefix   string `json:"DB_TABLE_PREFIX" envconfig:"DB_TABLE_PREFIX" default:""`
+	// reported as program_name in performance_schema.session_connect_attrs
+	AppName string `json:"DB_APP_NAME" envconfig:"DB_APP_NAME" default:""`
 
 	MaxOpenConns        int `json:"DB_MAX_OPEN_CONNS" envconfig:"DB_MAX_OPEN_CONNS" default:"10"`
 	MaxIdleConns        int `json:"DB_MAX_IDLE_CONNS" envconfig:"DB_MAX_IDLE_CONNS" default:"5"`
 	ConnMaxLifetimeMins int `json:"DB_CONN_MAX_LIFETIME_MINS" envconfig:"DB_CONN_MAX_LIFETIME_MINS" default:"5"`
+	// retry connecting in New while the db is starting, within StartupTimeoutMS in total
+	StartupRetries      int `json:"DB_STARTUP_RETRIES" envconfig:"DB_STARTUP_RETRIES" default:"0"`
+	StartupRetryDelayMS int `json:"DB_STARTUP_RETRY_DELAY_MS" envconfig:"DB_STARTUP_RETRY_DELAY_MS" default:"1000"`
+	StartupTimeoutMS    int `json:"DB_STARTUP_TIMEOUT_MS" envconfig:"DB_STARTUP_TIMEOUT_MS" default:"60000"`
+
+	// every write fails with ErrReadOnly before reaching the db, e.g. on a replica.
+	// Nothing is migrated on startup
+	ReadOnly bool `json:"DB_READ_ONLY" envconfig:"DB_READ_ONLY" default:"false"`
+
+	// how often OnPoolWait hooks receive the pool wait stats, 0 disables sampling
+	PoolStatsIntervalMS int `json:"DB_POOL_STATS_INTERVAL_MS" envconfig:"DB_POOL_STATS_INTERVAL_MS" default:"0"`
+
+	// open MaxIdleConns connections in New, see WarmPool
+	WarmupConns bool `json:"DB_WARMUP_CONNS" envconfig:"DB_WARMUP_CONNS" default:"false"`
+
+	// wraps every single write in its own transaction: safer, but an extra
+	// BEGIN/COMMIT round trip per write
+	UseDefaultTransaction bool `json:"DB_USE_DEFAULT_TRANSACTION" envconfig:"DB_USE_DEFAULT_TRANSACTION" default:"false"`
+	// lets nested transactions use savepoints, at the cost of an extra
+	// SAVEPOINT round trip per nested transaction
+	EnableNestedTransaction bool `json:"DB_ENABLE_NESTED_TRANSACTION" envconfig:"DB_ENABLE_NESTED_TRANSACTION" default:"false"`
+
+	// cache prepared statements, see gorm.Config.PrepareStmt
+	PrepareStmt bool `json:"DB_PREPARE_STMT" envconfig:"DB_PREPARE_STMT" default:"false"`
 
 	GormDebugMode bool   `json:"DB_GORM_DEBUG_MODE" envconfig:"DB_GORM_DEBUG_MODE" default:"false"`
 	Location      string `json:"DB_TIME_LOCATION" envconfig:"DB_TIME_LOCATION" default:"Europe/Moscow"`
+	// replaces time.Now for timestamps and expiration checks, e.g. a fake clock in tests
+	Clock func() time.Time `json:"-" ignored:"true"`
+
+	// applied on table creation, e.g. Engine "InnoDB", RowFormat "DYNAMIC", Charset "utf8mb4"
+	TableEngine    string `json:"DB_TABLE_ENGINE" envconfig:"DB_TABLE_ENGINE" default:""`
+	TableRowFormat string `json:"DB_TABLE_ROW_FORMAT" envconfig:"DB_TABLE_ROW_FORMAT" default:""`
+	TableCharset   string `json:"DB_TABLE_CHARSET" envconfig:"DB_TABLE_CHARSET" default:""`
+	TableComment   string `json:"DB_TABLE_COMMENT" envconfig:"DB_TABLE_COMMENT" default:"key-value entries managed by gorm-key-value"`
+	// overrides the default column comments by column name, e.g. {"value": "user settings"}.
+	// AutoMigrate alters existing columns whose comment differs
+	ColumnComments map[string]string `json:"-" ignored:"true"`
+
+	// json, longtext or longblob. Use longtext/longblob on servers without the JSON type
+	ValueColumnType string `json:"DB_VALUE_COLUMN_TYPE" envconfig:"DB_VALUE_COLUMN_TYPE" default:"json"`
+
+	// deadline of every query whose context has none, 0 waits indefinitely.
+	// Migrations, RepairSchema and Optimize are exempt
+	DefaultQueryTimeoutMS int `json:"DB_DEFAULT_QUERY_TIMEOUT_MS" envconfig:"DB_DEFAULT_QUERY_TIMEOUT_MS" default:"0"`
+	// queries slower than this are reported to OnSlowOrError hooks, 0 means the logger threshold
+	SlowQueryThresholdMS int `json:"DB_SLOW_QUERY_THRESHOLD_MS" envconfig:"DB_SLOW_QUERY_THRESHOLD_MS" default:"3000"`
+
+	// how many times a write is retried after a deadlock (1213) or lock wait timeout (1205)
+	WriteDeadlockRetries int `json:"DB_WRITE_DEADLOCK_RETRIES" envconfig:"DB_WRITE_DEADLOCK_RETRIES" default:"3"`
+
+	// adds a unique index on name, for deployments where name is the business key.
+	// Saving a name owned by another key fails with ErrNameTaken. Empty names are
+	// stored as NULL, outside the index, so entries without a name don't collide
+	UniqueName bool `json:"DB_UNIQUE_NAME" envconfig:"DB_UNIQUE_NAME" default:"false"`
+
+	// alter, safe or fail_on_drift, see MigrationMode
+	MigrationMode MigrationMode `json:"DB_MIGRATION_MODE" envconfig:"DB_MIGRATION_MODE" default:"alter"`
+
+	// never ALTER existing tables to add indexes on startup, leave it to DBAs.
+	// Also the way to open a table with duplicate keys for DedupeKeys, see ErrDuplicateKeys
+	SkipIndexMigration bool `json:"DB_SKIP_INDEX_MIGRATION" envconfig:"DB_SKIP_INDEX_MIGRATION" default:"false"`
+
+	// derives Name in SaveEntry when it is empty, so the entry is found by name searches.
+	// Empty names are saved as they are when nil
+	DefaultNameFn func(key string) string `json:"-" ignored:"true"`
+
+	// names longer than this are rejected with ErrNameTooLong, 0 disables the check.
+	// The name column holds 191 characters, which keeps its utf8mb4 index within 767 bytes
+	MaxNameBytes int `json:"DB_MAX_NAME_BYTES" envconfig:"DB_MAX_NAME_BYTES" default:"191"`
+
+	// GetAllEntrys fails with ErrTooManyEntries above this many rows, 0 disables the guard
+	MaxUnboundedFetch int `json:"DB_MAX_UNBOUNDED_FETCH" envconfig:"DB_MAX_UNBOUNDED_FETCH" default:"0"`
+
+	// SyncSince leaves out entries written this recently: updated_at is stamped before
+	// commit, so a page could otherwise pass a write that commits later. Keep it above
+	// the longest write transaction and the clock skew between writers
+	SyncSafetyWindowMS int `json:"DB_SYNC_SAFETY_WINDOW_MS" envconfig:"DB_SYNC_SAFETY_WINDOW_MS" default:"5000"`
+
+	// singular table name, e.g. "entry" instead of "entries"
+	SingularTable bool `json:"DB_SINGULAR_TABLE" envconfig:"DB_SINGULAR_TABLE" default:"false"`
+	// renames generated table names, e.g. strings.NewReplacer("Entry", "KV") for "kvs".
+	// Custom column names are not supported: raw conditions in this package use the
+	// default ones, so New rejects a replacer that changes an Entry column
+	NameReplacer schema.Replacer `json:"-" ignored:"true"`
+
+	// optional privileged connection used only to migrate on startup,
+	// e.g. when the app user has no ALTER grant. Table naming is taken from the main config
+	Migration *DBConfig `json:"DB_MIGRATION,omitempty" ignored:"true"`
 }
 
 type Memory interface {
 	IsEntryExists(Entry) (bool, error)
 	GetAllEntrys() ([]Entry, error)
 	GetEntrysLikeName(namePattern string) ([]Entry, error)
+	GetEntriesLikeNameLimit(namePattern string, limit int) ([]Entry, error)
+	GetEntriesNotLikeName(namePattern string) ([]Entry, error)
+	GetEntriesLikeAnyName(patterns []string) ([]Entry, error)
+	GetAllEntriesMap() (map[string]Entry, error)
+	GetEntriesLikeNameMap(namePattern string) (map[string]Entry, error)
 	GetEntry(key string) (Entry, error)
+	GetEntryByNameUnique(name string) (Entry, error)
+	GetEntryByKeyOrName(s string) (Entry, error)
+	EntryAge(key string) (time.Duration, error)
+	GetRandomEntries(n int) ([]Entry, error)
+	GetEntriesProjected(fields []string, limit int) ([]Entry, error)
+	GetEntriesWithEmptyValue() ([]Entry, error)
+	CountEntriesWithEmptyValue() (int64, error)
+	GetEntriesByTag(tag string) ([]Entry, error)
+	AddTag(key, tag string) error
+	RemoveTag(key, tag string) error
+	GetEntriesByNameAndJSONField(name, jsonPath string, value interface{}) ([]Entry, error)
+	PopEntry(key string) (Entry, error)
+	PopAnyByNamePrefix(prefix string) (Entry, bool, error)
 	SaveEntry(e Entry) error
+	SaveEntryMerge(e Entry) error
+	SetValueIfUnchanged(key string, expectedOldValue, newValue []byte) (bool, error)
+	SaveEntryIfAbsent(e Entry) (bool, error)
+	ClaimKey(key string, value []byte) (bool, error)
+	GetOrGenerate(key string, gen func() ([]byte, error)) (Entry, error)
+	SaveKV(key string, value []byte) error
+	SaveAndGet(e Entry) (Entry, error)
+	InsertEntry(e *Entry) error
+	SaveEntries(entries []Entry) error
+	SaveEntriesBatched(entries []Entry, batchSize int) error
+	ImportEntries(entries []Entry, policy ConflictPolicy) error
+	SaveEntriesPartial(entries []Entry) (okCount int64, failures map[int]error, err error)
+	Lock(key string, ttl time.Duration) (unlock func() error, acquired bool, err error)
+	ListLocks() ([]Entry, error)
+	PurgeExpiredLocks() (int64, error)
+	MergePatchValue(key string, patch []byte) error
+	AppendToJSONArray(key string, element []byte) error
+	SetTimestamps(key string, createdAt, updatedAt time.Time) error
+	DeleteEntriesByIDs(ids []uint64) (int64, error)
+	TouchEntries(keys []string) (int64, error)
+	GetEntriesByKeysConcurrent(keys []string, chunkSize, concurrency int) (map[string]Entry, error)
+	GetEntriesByKeysOrdered(keys []string, placeholders bool) ([]Entry, error)
+	DeleteEntriesOlderThan(t time.Time, column TimestampColumn) (int64, error)
+	CountEntriesOlderThan(t time.Time, column TimestampColumn) (int64, error)
+	FindDuplicateKeys() (map[string]int64, error)
+	DedupeKeys(keep string) (int64, error)
+	Query() *EntryQuery
+	RawQueryEntries(statement string, args ...interface{}) ([]Entry, error)
+	Health(ctx context.Context) (HealthReport, error)
+	WarmPool(ctx context.Context) error
+	Close() error
+	ValueSizeHistogram(buckets []int) (map[int]int64, error)
+	CountEntriesGroupedByName() (map[string]int64, error)
+	CountEntriesByDay(from, to time.Time) (map[string]int64, error)
+	ExportCSV(ctx context.Context, w io.Writer) error
+	ExportJSON(ctx context.Context, w io.Writer, opts ExportJSONOptions) error
+	Snapshot(ctx context.Context, w io.Writer) error
+	Restore(ctx context.Context, r io.Reader) error
+	SyncSince(token string, limit int) ([]Entry, string, error)
+	DeleteNamespace(ns string) (int64, error)
+	RekeyPrefix(oldPrefix, newPrefix string) (int64, error)
+	OnAfterSave(fn func(Entry))
+	AddEventHandler(h EventHandler)
+	DroppedEvents() int64
+	OnSlowOrError(fn func(op, sql string, dur time.Duration, err error))
+	OnPoolWait(fn func(waitCount int64, waitDuration time.Duration))
+	LastError() error
+	SetValueSchema(schema []byte) error
+	IncrementEntry(key string, delta int64) (int64, error)
+
+	VerifySchema() ([]string, error)
+	RepairSchema() error
+	ManagedTables() []string
+	Optimize() error
+	WithPrefix(prefix string) (Memory, error)
+	WithSession(session *gorm.Session) Memory
+	GormDB() *gorm.DB
 }
 
 type Entry struct {
@@ -61,29 +257,52 @@ type Entry struct {
 	CreatedAt time.Time `gorm:"index"`
 	UpdatedAt time.Time `gorm:"index"`
 
-	Key   string `gorm:"index"`
-	Name  string `gorm:"index"`
-	Value []byte `gorm:"type:json"`
+	Key   string `gorm:"size:191;uniqueIndex:idx_entries_key_unique;comment:unique lookup key"`
+	Name  string `gorm:"size:191;index;comment:human readable name, not unique"`
+	Value []byte `gorm:"type:json;comment:stored value, JSON by default"`
+	// labels set on insert, later changed with AddTag and RemoveTag only:
+	// SaveEntry leaves the tags of an existing key as they are
+	Tags []string `gorm:"type:json;serializer:json;comment:JSON array of labels"`
 }
 
 func GetDBConnectionURI(cfg DBConfig) string {
-	return fmt.Sprintf(
+	uri := fmt.Sprintf(
 		"%s:%s@tcp(%s:%d)/%s?timeout=%dms&parseTime=true",
 		cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.Name, cfg.ConnTimeoutMS,
 	)
+	if cfg.AppName != "" {
+		uri += "&connectionAttributes=" + url.QueryEscape("program_name:"+cfg.AppName)
+	}
+	return uri
 }
 
-func New(cfg DBConfig) (Memory, error) {
-	lg := logger.New(
-		log.New(os.Stdout, "\r\n", log.LstdFlags), // io writer
-		logger.Config{
-			SlowThreshold:             dbLoggerSlowSQLTreshold,
-			LogLevel:                  dbLoggerLevel,
-			IgnoreRecordNotFoundError: dbLoggerIgnoreNotFoundErr,
-			Colorful:                  dbLoggerColorEnabled,
-		},
-	)
+func getTablePrefix(cfg DBConfig) string {
+	if cfg.TablePrefix == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s_", cfg.TablePrefix)
+}
+
+func openConnection(cfg DBConfig) (*sql.DB, error) {
+	var deadline time.Time
+	if cfg.StartupTimeoutMS > 0 {
+		deadline = time.Now().Add(time.Duration(cfg.StartupTimeoutMS) * time.Millisecond)
+	}
+	retryDelay := time.Duration(cfg.StartupRetryDelayMS) * time.Millisecond
+
+	conn, err := tryOpenConnection(cfg)
+	for attempt := 1; err != nil && attempt <= cfg.StartupRetries; attempt++ {
+		if !deadline.IsZero() && time.Now().Add(retryDelay).After(deadline) {
+			break
+		}
 
+		time.Sleep(retryDelay)
+		conn, err = tryOpenConnection(cfg)
+	}
+	return conn, err
+}
+
+func tryOpenConnection(cfg DBConfig) (*sql.DB, error) {
 	var err error
 	var conn *sql.DB
 	var connErr error
@@ -95,54 +314,182 @@ func New(cfg DBConfig) (Memory, error) {
 	}
 
 	conn.SetMaxOpenConns(cfg.MaxOpenConns)
+	// 0 keeps the database/sql default of 2 idle connections
+	if cfg.MaxIdleConns > 0 {
+		conn.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
 
 	if err := conn.Ping(); err != nil {
+		conn.Close()
 		return nil, fmt.Errorf("ping db: %w", err)
 	}
+	return conn, nil
+}
 
-	mysqlConnConfig := mysql.New(mysql.Config{
-		Conn: conn,
-	})
-
-	prefix := ""
-	if cfg.TablePrefix != "" {
-		prefix = fmt.Sprintf("%s_", cfg.TablePrefix)
+func getQueryHooks(cfg DBConfig) *queryHooks {
+	threshold := time.Duration(cfg.SlowQueryThresholdMS) * time.Millisecond
+	if threshold <= 0 {
+		threshold = dbLoggerSlowSQLTreshold
 	}
+	return &queryHooks{slowThreshold: threshold}
+}
+
+func newGormConfig(cfg DBConfig, hooks *queryHooks) *gorm.Config {
+	lg := logger.New(
+		log.New(os.Stdout, "\r\n", log.LstdFlags), // io writer
+		logger.Config{
+			SlowThreshold:             dbLoggerSlowSQLTreshold,
+			LogLevel:                  dbLoggerLevel,
+			IgnoreRecordNotFoundError: dbLoggerIgnoreNotFoundErr,
+			Colorful:                  dbLoggerColorEnabled,
+		},
+	)
 
-	gormConfig := &gorm.Config{
-		SkipDefaultTransaction:   true,
-		DisableNestedTransaction: true,
-		Logger:                   lg,
+	return &gorm.Config{
+		SkipDefaultTransaction:   !cfg.UseDefaultTransaction,
+		DisableNestedTransaction: !cfg.EnableNestedTransaction,
+		PrepareStmt:              cfg.PrepareStmt,
+		Logger:                   &hookedLogger{Interface: lg, hooks: hooks},
 		NowFunc: func() time.Time {
 			ti, err := time.LoadLocation(cfg.Location)
 			if err != nil {
 				panic(err)
 			}
 
+			if cfg.Clock != nil {
+				return cfg.Clock().In(ti)
+			}
 			return time.Now().In(ti)
 		},
 		NamingStrategy: schema.NamingStrategy{
-			TablePrefix: prefix,
+			TablePrefix:   getTablePrefix(cfg),
+			SingularTable: cfg.SingularTable,
+			NameReplacer:  cfg.NameReplacer,
 		},
 	}
+}
+
+func openGorm(conn *sql.DB, cfg DBConfig, hooks *queryHooks) (*gorm.DB, error) {
+	return openGormWith(mysql.New(mysql.Config{Conn: conn}), newGormConfig(cfg, hooks), cfg)
+}
+
+// openGormView opens gorm on conn for the config of a view of parent without a round
+// trip: the pool is already pinged and the server version parent detected is reused
+func openGormView(parent *gorm.DB, conn *sql.DB, cfg DBConfig, hooks *queryHooks) (*gorm.DB, error) {
+	mysqlConfig := mysql.Config{Conn: conn}
+	if dialector, ok := parent.Dialector.(*mysql.Dialector); ok {
+		mysqlConfig = *dialector.Config
+		mysqlConfig.Conn = conn
+		mysqlConfig.SkipInitializeWithVersion = true
+	}
 
-	gormConn, err := gorm.Open(mysqlConnConfig, gormConfig)
+	gormConfig := newGormConfig(cfg, hooks)
+	gormConfig.DisableAutomaticPing = true
+	gormConfig.DryRun = parent.DryRun
+	gormConfig.Logger = parent.Logger
+	return openGormWith(mysql.New(mysqlConfig), gormConfig, cfg)
+}
+
+func openGormWith(dialector gorm.Dialector, gormConfig *gorm.Config, cfg DBConfig) (*gorm.DB, error) {
+	gormConn, err := gorm.Open(dialector, gormConfig)
 	if err != nil {
 		return nil, fmt.Errorf("open gorm conn: %w", err)
 	}
 
-	// migrate
-	for _, prefab := range models {
-		if err := gormConn.AutoMigrate(prefab); err != nil {
-			return nil, fmt.Errorf("migrate: %w", err)
+	if cfg.ReadOnly {
+		if err := registerReadOnly(gormConn); err != nil {
+			return nil, fmt.Errorf("open gorm conn: %w", err)
 		}
 	}
+	if cfg.DefaultQueryTimeoutMS > 0 {
+		timeout := time.Duration(cfg.DefaultQueryTimeoutMS) * time.Millisecond
+		if err := registerQueryTimeout(gormConn, timeout); err != nil {
+			return nil, fmt.Errorf("open gorm conn: %w", err)
+		}
+	}
+	return gormConn, nil
+}
 
-	return &dbHandler{
-		conn:         conn,
-		gorm:         gormConn,
-		tablesPrefix: prefix,
-	}, nil
+func New(cfg DBConfig) (Memory, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	conn, err := openConnection(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newHandler(conn, cfg, true)
+}
+
+// NewWithDB wraps a connection configured by the caller, e.g. with a tracing driver.
+// Connection settings of cfg are ignored and Close leaves conn open
+func NewWithDB(conn *sql.DB, cfg DBConfig) (Memory, error) {
+	if err := cfg.validateStoreSettings(); err != nil {
+		return nil, err
+	}
+	return newHandler(conn, cfg, false)
+}
+
+func newHandler(conn *sql.DB, cfg DBConfig, ownsConn bool) (Memory, error) {
+	valueColumnType, err := getValueColumnType(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateNameReplacer(cfg.NameReplacer); err != nil {
+		return nil, err
+	}
+
+	queryHooks := getQueryHooks(cfg)
+	gormConn, err := openGorm(conn, cfg, queryHooks)
+	if err != nil {
+		return nil, err
+	}
+
+	handler := &dbHandler{
+		cfg:             cfg,
+		conn:            conn,
+		ownsConn:        ownsConn,
+		gorm:            gormConn,
+		ownsStmtCache:   true,
+		prefixViews:     newPrefixViews(),
+		tablesPrefix:    getTablePrefix(cfg),
+		tableOptions:    getTableOptions(cfg),
+		valueColumnType: valueColumnType,
+		deadlockRetries: cfg.WriteDeadlockRetries,
+
+		skipIndexMigration: cfg.SkipIndexMigration,
+
+		hooks:      &entryHooks{},
+		queryHooks: queryHooks,
+		validator:  &valueValidator{},
+	}
+
+	// also when the migration runs elsewhere, writes depend on the model options
+	if err := handler.applyModelOptions(); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case cfg.ReadOnly:
+		// the schema is owned by a writable store
+	case cfg.Migration != nil:
+		err = handler.migrateWithConfig(*cfg.Migration, cfg)
+	default:
+		err = handler.migrate()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.WarmupConns {
+		if err := handler.WarmPool(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+
+	handler.poolWait = newPoolWaitCollector(conn, time.Duration(cfg.PoolStatsIntervalMS)*time.Millisecond)
+	return handler, nil
 }
 
 func (db *dbHandler) IsEntryExists(e Entry) (bool, error) {
@@ -156,13 +503,24 @@ func (db *dbHandler) IsEntryExists(e Entry) (bool, error) {
 	return true, nil
 }
 
+// GetAllEntrys returns entries ordered by id, so repeated calls give the same order.
+// It loads the whole table: with MaxUnboundedFetch set it returns
+// ErrTooManyEntries once the table holds more rows than that
 func (db *dbHandler) GetAllEntrys() ([]Entry, error) {
 	entrys := []Entry{}
 
-	result := db.gorm.Model(&Entry{}).Find(&entrys)
+	tx := db.gorm.Model(&Entry{}).Order("id ASC")
+	if db.cfg.MaxUnboundedFetch > 0 {
+		tx = tx.Limit(db.cfg.MaxUnboundedFetch + 1)
+	}
+
+	result := tx.Find(&entrys)
 	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 		return nil, nil
 	}
+	if result.Error == nil && db.cfg.MaxUnboundedFetch > 0 && len(entrys) > db.cfg.MaxUnboundedFetch {
+		return nil, ErrTooManyEntries
+	}
 
 	return entrys, result.Error
 }
@@ -170,7 +528,7 @@ func (db *dbHandler) GetAllEntrys() ([]Entry, error) {
 func (db *dbHandler) GetEntrysLikeName(namePattern string) ([]Entry, error) {
 	entrys := []Entry{}
 
-	result := db.gorm.Model(&Entry{}).Where("key = ?", namePattern).Find(&entrys)
+	result := db.gorm.Model(&Entry{}).Where("name LIKE ?", namePattern).Find(&entrys)
 	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 		return nil, nil
 	}
@@ -178,15 +536,524 @@ func (db *dbHandler) GetEntrysLikeName(namePattern string) ([]Entry, error) {
 	return entrys, result.Error
 }
 
+func (db *dbHandler) GetEntriesLikeNameLimit(namePattern string, limit int) ([]Entry, error) {
+	limit, err := normalizeLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	entrys := []Entry{}
+	err = db.gorm.Model(&Entry{}).
+		Where("name LIKE ?", namePattern).
+		Order("name ASC").Order("id ASC").
+		Limit(limit).
+		Find(&entrys).Error
+	if err != nil {
+		return nil, fmt.Errorf("get entries like name: %w", err)
+	}
+	return entrys, nil
+}
+
+// GetEntriesLikeAnyName returns entries whose name is like any of the patterns,
+// up to 50 of them. No patterns return no entries
+func (db *dbHandler) GetEntriesLikeAnyName(patterns []string) ([]Entry, error) {
+	if len(patterns) == 0 {
+		return []Entry{}, nil
+	}
+	return db.Query().NameLikeAny(patterns...).Find()
+}
+
+func (db *dbHandler) GetEntriesNotLikeName(namePattern string) ([]Entry, error) {
+	return db.Query().NameNotLike(namePattern).Find()
+}
+
+// GetEntriesByNameAndJSONField returns entries with the exact name whose value has
+// value at jsonPath, e.g. "$.status". The name index narrows the rows before the JSON scan
+func (db *dbHandler) GetEntriesByNameAndJSONField(name, jsonPath string, value interface{}) ([]Entry, error) {
+	return db.Query().NameEquals(name).JSONPathEquals(jsonPath, value).Find()
+}
+
+// emptyValueCondition matches a NULL value, and also a zero-length value for
+// the longtext/longblob column types or JSON null, {} and [] for the json column type
+func (db *dbHandler) emptyValueCondition() string {
+	if db.valueColumnType == ValueColumnJSON {
+		return "`value` IS NULL OR JSON_TYPE(`value`) = 'NULL' OR JSON_LENGTH(`value`) = 0"
+	}
+	return "`value` IS NULL OR LENGTH(`value`) = 0"
+}
+
+// GetEntriesWithEmptyValue returns entries that were never given a value,
+// see emptyValueCondition for what counts as empty
+func (db *dbHandler) GetEntriesWithEmptyValue() ([]Entry, error) {
+	entrys := []Entry{}
+	if err := db.gorm.Where(db.emptyValueCondition()).Order("id ASC").Find(&entrys).Error; err != nil {
+		return nil, fmt.Errorf("get entries with empty value: %w", err)
+	}
+	return entrys, nil
+}
+
+func (db *dbHandler) CountEntriesWithEmptyValue() (int64, error) {
+	var count int64
+	if err := db.gorm.Model(&Entry{}).Where(db.emptyValueCondition()).Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("count entries with empty value: %w", err)
+	}
+	return count, nil
+}
+
+func (db *dbHandler) GetEntriesProjected(fields []string, limit int) ([]Entry, error) {
+	return db.Query().Fields(fields...).Limit(limit).Find()
+}
+
+func (db *dbHandler) GetAllEntriesMap() (map[string]Entry, error) {
+	entrys, err := db.GetAllEntrys()
+	if err != nil {
+		return nil, err
+	}
+	return entriesByKey(entrys), nil
+}
+
+func (db *dbHandler) GetEntriesLikeNameMap(namePattern string) (map[string]Entry, error) {
+	entrys, err := db.GetEntrysLikeName(namePattern)
+	if err != nil {
+		return nil, err
+	}
+	return entriesByKey(entrys), nil
+}
+
+// entriesByKey keeps the most recently updated entry (then the highest id)
+// when several rows share a key
+func entriesByKey(entrys []Entry) map[string]Entry {
+	result := make(map[string]Entry, len(entrys))
+	for _, e := range entrys {
+		existing, found := result[e.Key]
+		if found && (existing.UpdatedAt.After(e.UpdatedAt) ||
+			existing.UpdatedAt.Equal(e.UpdatedAt) && existing.ID > e.ID) {
+			continue
+		}
+		result[e.Key] = e
+	}
+	return result
+}
+
 func (db *dbHandler) GetEntry(key string) (Entry, error) {
 	e := Entry{Key: key}
 	err := db.gorm.Model(&Entry{}).Where(&e).First(&e).Error
 	return e, err
 }
 
+// EntryAge returns how long ago the entry was last written, measured with the configured clock
+func (db *dbHandler) EntryAge(key string) (time.Duration, error) {
+	var e Entry
+	if err := db.gorm.Model(&Entry{}).Select("updated_at").Where("`key` = ?", key).Take(&e).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, ErrEntryNotFound
+		}
+		return 0, fmt.Errorf("get entry age: %w", err)
+	}
+	return db.gorm.NowFunc().Sub(e.UpdatedAt), nil
+}
+
+// GetEntryByNameUnique expects DBConfig.UniqueName, so at most one entry has the name.
+// Entries without a name are not unique, so the empty name is never found
+func (db *dbHandler) GetEntryByNameUnique(name string) (Entry, error) {
+	if name == "" {
+		return Entry{}, ErrEntryNotFound
+	}
+
+	var e Entry
+	if err := db.gorm.Model(&Entry{}).Where("name = ?", name).Take(&e).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Entry{}, ErrEntryNotFound
+		}
+		return Entry{}, fmt.Errorf("get entry by name: %w", err)
+	}
+	return e, nil
+}
+
+// GetEntryByKeyOrName looks the entry up by key and, on a miss, runs a second
+// query by name, returning the first entry with that name
+func (db *dbHandler) GetEntryByKeyOrName(s string) (Entry, error) {
+	e, err := db.GetEntry(s)
+	if err == nil {
+		return e, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return Entry{}, fmt.Errorf("get entry by key: %w", err)
+	}
+
+	e = Entry{Name: s}
+	if err := db.gorm.Model(&Entry{}).Where(&e).First(&e).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Entry{}, ErrEntryNotFound
+		}
+		return Entry{}, fmt.Errorf("get entry by name: %w", err)
+	}
+	return e, nil
+}
+
+// GetRandomEntries uses ORDER BY RAND(), which scans the whole table.
+// Keep it for spot-checks, not for hot paths on large tables
+func (db *dbHandler) GetRandomEntries(n int) ([]Entry, error) {
+	limit, err := normalizeLimit(n)
+	if err != nil {
+		return nil, err
+	}
+
+	entrys := []Entry{}
+	if err := db.gorm.Model(&Entry{}).Order("RAND()").Limit(limit).Find(&entrys).Error; err != nil {
+		return nil, fmt.Errorf("get random entries: %w", err)
+	}
+	return entrys, nil
+}
+
+// SaveEntry writes the entry as given: on an existing key name and value are
+// overwritten even when empty. Use SaveEntryMerge for partial updates.
+// The entry is matched by key and e.ID is ignored, so saving with the ID of
+// another entry doesn't rename that entry's key: it saves a new entry
 func (db *dbHandler) SaveEntry(e Entry) error {
-	if err := db.gorm.Save(&e).Error; err != nil {
+	if err := db.validator.validate(e.Value); err != nil {
+		return err
+	}
+	if e.Name == "" && db.cfg.DefaultNameFn != nil {
+		e.Name = db.cfg.DefaultNameFn(e.Key)
+	}
+	if err := db.validateName(e.Name); err != nil {
+		return err
+	}
+
+	err := db.withWriteRetry(func() error {
+		return db.upsertEntry(db.gorm, &e)
+	})
+	if err != nil {
 		return fmt.Errorf("save entry: %w", err)
 	}
+
+	db.hooks.fireAfterSave(e)
+	return nil
+}
+
+func (db *dbHandler) validateName(name string) error {
+	if db.cfg.MaxNameBytes > 0 && len(name) > db.cfg.MaxNameBytes {
+		return fmt.Errorf("%w: %d bytes, at most %d", ErrNameTooLong, len(name), db.cfg.MaxNameBytes)
+	}
+	return nil
+}
+
+func (db *dbHandler) upsertEntry(tx *gorm.DB, e *Entry) error {
+	return db.upsertOnKey(tx, e, clause.AssignmentColumns([]string{"name", "value", "updated_at"}))
+}
+
+// upsertOnKey inserts e or applies set to the entry with the same key. With UniqueName
+// it can't be a single upsert: ON DUPLICATE KEY UPDATE also fires on a name taken by
+// another key and would overwrite that entry instead, so the row is locked and then
+// updated or inserted, and a taken name fails with ErrNameTaken.
+// e.ID is ignored and set to the ID of the written entry
+func (db *dbHandler) upsertOnKey(tx *gorm.DB, e *Entry, set clause.Set) error {
+	// an ID would make the insert conflict on the primary key of another entry
+	e.ID = 0
+	if !db.cfg.UniqueName {
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "key"}},
+			DoUpdates: set,
+		}).Create(e).Error
+	}
+
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		var existing Entry
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("`key` = ?", e.Key).Take(&existing).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return tx.Create(e).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		if e.UpdatedAt.IsZero() {
+			e.UpdatedAt = tx.NowFunc()
+		}
+		updates, err := db.assignmentValues(tx, e, set)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&existing).UpdateColumns(updates).Error; err != nil {
+			return err
+		}
+
+		e.ID = existing.ID
+		e.CreatedAt = existing.CreatedAt
+		return nil
+	})
+	if isDuplicateEntryErr(err) {
+		return fmt.Errorf("%w: %q", ErrNameTaken, e.Name)
+	}
+	return err
+}
+
+// assignmentValues turns the upsert assignments into UPDATE values,
+// taking the columns copied from the inserted row from e
+func (db *dbHandler) assignmentValues(tx *gorm.DB, e *Entry, set clause.Set) (map[string]interface{}, error) {
+	s, err := db.parseModel(&Entry{})
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make(map[string]interface{}, len(set))
+	for _, assignment := range set {
+		column, ok := assignment.Value.(clause.Column)
+		if !ok || column.Table != "excluded" {
+			updates[assignment.Column.Name] = assignment.Value
+			continue
+		}
+
+		field := s.LookUpField(column.Name)
+		if field == nil {
+			return nil, fmt.Errorf("column %s not found in %s", column.Name, s.Table)
+		}
+		updates[assignment.Column.Name], _ = field.ValueOf(tx.Statement.Context, reflect.ValueOf(e).Elem())
+	}
+	return updates, nil
+}
+
+// SaveAndGet saves the entry and reads it back in the same transaction,
+// so the read can't be served by a lagging replica
+func (db *dbHandler) SaveAndGet(e Entry) (Entry, error) {
+	if err := db.validator.validate(e.Value); err != nil {
+		return Entry{}, err
+	}
+	if err := db.validateName(e.Name); err != nil {
+		return Entry{}, err
+	}
+
+	var stored Entry
+	err := db.withWriteRetry(func() error {
+		return db.gorm.Transaction(func(tx *gorm.DB) error {
+			if err := db.upsertEntry(tx, &e); err != nil {
+				return err
+			}
+
+			return tx.Model(&Entry{}).Where("`key` = ?", e.Key).First(&stored).Error
+		})
+	})
+	if err != nil {
+		return Entry{}, fmt.Errorf("save and get entry: %w", err)
+	}
+
+	db.hooks.fireAfterSave(stored)
+	return stored, nil
+}
+
+// SaveEntryMerge upserts the entry by key but leaves the stored name and value
+// untouched when they are empty in e, so a partial entry can't wipe them.
+// A new key is inserted as given
+func (db *dbHandler) SaveEntryMerge(e Entry) error {
+	if err := db.validateName(e.Name); err != nil {
+		return err
+	}
+
+	columns := []string{"updated_at"}
+	if e.Name != "" {
+		columns = append(columns, "name")
+	}
+	if len(e.Value) > 0 {
+		if err := db.validator.validate(e.Value); err != nil {
+			return err
+		}
+		columns = append(columns, "value")
+	}
+
+	stored := e
+	err := db.withWriteRetry(func() error {
+		if !db.hooks.hasListeners() {
+			return db.upsertOnKey(db.gorm, &e, clause.AssignmentColumns(columns))
+		}
+
+		// hooks get the merged entry rather than the partial input
+		return db.gorm.Transaction(func(tx *gorm.DB) error {
+			if err := db.upsertOnKey(tx, &e, clause.AssignmentColumns(columns)); err != nil {
+				return err
+			}
+
+			var merged Entry
+			if err := tx.Model(&Entry{}).Where("`key` = ?", e.Key).First(&merged).Error; err != nil {
+				return err
+			}
+			stored = merged
+			return nil
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("save entry merge: %w", err)
+	}
+
+	db.hooks.fireAfterSave(stored)
+	return nil
+}
+
+// SetValueIfUnchanged replaces the value of key only while it still equals expectedOldValue
+// and reports whether it did. With the json column type values are compared as JSON,
+// so formatting differences don't count as a change. OnAfterSave hooks are not called
+func (db *dbHandler) SetValueIfUnchanged(key string, expectedOldValue, newValue []byte) (bool, error) {
+	if key == "" {
+		return false, ErrEmptyKey
+	}
+	if err := db.validator.validate(newValue); err != nil {
+		return false, err
+	}
+
+	condition := "`value` = ?"
+	if db.valueColumnType == ValueColumnJSON {
+		condition = "`value` = CAST(? AS JSON)"
+	}
+
+	result := db.gorm.Model(&Entry{}).
+		Where("`key` = ?", key).
+		Where(condition, string(expectedOldValue)).
+		Updates(map[string]interface{}{"value": newValue, "updated_at": db.gorm.NowFunc()})
+	if result.Error != nil {
+		return false, fmt.Errorf("set value if unchanged: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	db.fireSaved(key)
+	return true, nil
+}
+
+// SaveKV saves the value with the name set to the key, so it is found by name searches
+func (db *dbHandler) SaveKV(key string, value []byte) error {
+	return db.SaveEntry(Entry{Key: key, Name: key, Value: value})
+}
+
+func (db *dbHandler) SaveEntryIfAbsent(e Entry) (bool, error) {
+	if err := db.validator.validate(e.Value); err != nil {
+		return false, err
+	}
+	if err := db.validateName(e.Name); err != nil {
+		return false, err
+	}
+
+	created, err := db.createIfAbsent(&e)
+	if err != nil {
+		return false, fmt.Errorf("save entry if absent: %w", err)
+	}
+
+	if created {
+		db.hooks.fireAfterSave(e)
+	}
+	return created, nil
+}
+
+// ClaimKey stores value under key only if the key is free and reports whether this
+// call created it. An existing entry is never overwritten, which makes it the
+// primitive for allocating unique ids or slugs
+func (db *dbHandler) ClaimKey(key string, value []byte) (bool, error) {
+	claimed, err := db.SaveEntryIfAbsent(Entry{Key: key, Name: key, Value: value})
+	if err != nil {
+		return false, fmt.Errorf("claim key: %w", err)
+	}
+	return claimed, nil
+}
+
+// GetOrGenerate returns the entry of key, or stores the value from gen and returns
+// the new entry. gen only runs on a miss. Concurrent callers may each run gen on the
+// same miss, but only the first insert wins and every caller gets that entry
+func (db *dbHandler) GetOrGenerate(key string, gen func() ([]byte, error)) (Entry, error) {
+	e, err := db.GetEntry(key)
+	if err == nil {
+		return e, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return Entry{}, fmt.Errorf("get or generate: %w", err)
+	}
+
+	value, err := gen()
+	if err != nil {
+		return Entry{}, fmt.Errorf("generate value: %w", err)
+	}
+
+	e = Entry{Key: key, Name: key, Value: value}
+	if err := db.validator.validate(e.Value); err != nil {
+		return Entry{}, err
+	}
+	if err := db.validateName(e.Name); err != nil {
+		return Entry{}, err
+	}
+	created, err := db.createIfAbsent(&e)
+	if err != nil {
+		return Entry{}, fmt.Errorf("get or generate: %w", err)
+	}
+	if created {
+		db.hooks.fireAfterSave(e)
+		return e, nil
+	}
+
+	// lost the race, return the winner's entry
+	e, err = db.GetEntry(key)
+	if err != nil {
+		return Entry{}, fmt.Errorf("get or generate: %w", err)
+	}
+	return e, nil
+}
+
+// InsertEntry creates a new entry and fills in its generated ID and timestamps
+func (db *dbHandler) InsertEntry(e *Entry) error {
+	if err := db.validator.validate(e.Value); err != nil {
+		return err
+	}
+	if err := db.validateName(e.Name); err != nil {
+		return err
+	}
+
+	err := db.withWriteRetry(func() error {
+		return db.gorm.Create(e).Error
+	})
+	if err != nil {
+		return fmt.Errorf("insert entry: %w", err)
+	}
+
+	db.hooks.fireAfterSave(*e)
+	return nil
+}
+
+func (db *dbHandler) createIfAbsent(e *Entry) (bool, error) {
+	var created bool
+	err := db.withWriteRetry(func() error {
+		result := db.gorm.Clauses(clause.OnConflict{DoNothing: true}).Create(e)
+		created = result.RowsAffected > 0
+		return result.Error
+	})
+	if err != nil || created || !db.cfg.UniqueName || e.Name == "" {
+		return created, err
+	}
+
+	// the insert was also skipped for a name owned by another key
+	var count int64
+	if err := db.gorm.Model(&Entry{}).Where("`key` = ?", e.Key).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count == 0 {
+		return false, fmt.Errorf("%w: %q", ErrNameTaken, e.Name)
+	}
+	return false, nil
+}
+
+func (db *dbHandler) Close() error {
+	if !db.isView {
+		db.hooks.events.close()
+		db.poolWait.close()
+		db.prefixViews.close()
+	}
+
+	if stmtDB, ok := db.gorm.ConnPool.(*gorm.PreparedStmtDB); ok && db.ownsStmtCache {
+		stmtDB.Close()
+	}
+
+	if !db.ownsConn {
+		return nil
+	}
+	if err := db.conn.Close(); err != nil {
+		return fmt.Errorf("close db: %w", err)
+	}
 	return nil
 }
@@ -0,0 +1,148 @@
+package gormkeyvalue
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// BenchmarkPrepareStmt compares a save and a read per iteration with and without the
+// prepared statement cache. It needs a MySQL server configured by the DB_* variables:
+//
+//	DB_NAME=test DB_USER=root go test -run '^$' -bench PrepareStmt
+func BenchmarkPrepareStmt(b *testing.B) {
+	cfg, err := DBConfigFromEnv()
+	if err != nil {
+		b.Skipf("no database configured: %v", err)
+	}
+	cfg.TablePrefix = "bench_prepare_stmt"
+
+	for _, prepare := range []bool{false, true} {
+		b.Run(fmt.Sprintf("PrepareStmt=%v", prepare), func(b *testing.B) {
+			cfg.PrepareStmt = prepare
+			m, err := New(cfg)
+			if err != nil {
+				b.Fatalf("new: %v", err)
+			}
+			defer m.Close()
+
+			value := []byte(`{"n":1}`)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				key := fmt.Sprintf("key-%d", i%1000)
+				if err := m.SaveEntry(Entry{Key: key, Name: key, Value: value}); err != nil {
+					b.Fatalf("save entry: %v", err)
+				}
+				if _, err := m.GetEntry(key); err != nil {
+					b.Fatalf("get entry: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestEmptyKeyIsRejected(t *testing.T) {
+	m, recorder := NewWithRecorder()
+
+	// without a key predicate these would touch every row
+	tests := []struct {
+		name  string
+		write func() error
+	}{
+		{"SetValueIfUnchanged", func() error {
+			_, err := m.SetValueIfUnchanged("", []byte(`1`), []byte(`2`))
+			return err
+		}},
+		{"AddTag", func() error { return m.AddTag("", "tag") }},
+		{"RemoveTag", func() error { return m.RemoveTag("", "tag") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder.Reset()
+			if err := tt.write(); !errors.Is(err, ErrEmptyKey) {
+				t.Errorf("err = %v, want ErrEmptyKey", err)
+			}
+			if sql := recorder.Last(); sql != "" {
+				t.Errorf("ran %q", sql)
+			}
+		})
+	}
+}
+
+func TestSetValueIfUnchangedFiltersByKey(t *testing.T) {
+	m, recorder := NewWithRecorder()
+
+	if _, err := m.SetValueIfUnchanged("k", []byte(`1`), []byte(`2`)); err != nil {
+		t.Fatalf("set value if unchanged: %v", err)
+	}
+	if sql := recorder.Last(); !strings.Contains(sql, "WHERE `key` = 'k' AND `value` = CAST('1' AS JSON)") {
+		t.Errorf("statement %q lacks the key predicate", sql)
+	}
+}
+
+func TestEntryAgeFiltersByKey(t *testing.T) {
+	m, recorder := NewWithRecorder()
+
+	if _, err := m.EntryAge(""); err != nil {
+		t.Fatalf("entry age: %v", err)
+	}
+	if sql := recorder.Last(); !strings.Contains(sql, "WHERE `key` = ''") {
+		t.Errorf("statement %q lacks the key predicate", sql)
+	}
+}
+
+func TestUniqueNameStoresEmptyNameAsNull(t *testing.T) {
+	m, recorder := NewWithRecorder()
+	db := m.(*dbHandler)
+	db.cfg.UniqueName = true
+	if err := db.applyModelOptions(); err != nil {
+		t.Fatalf("apply model options: %v", err)
+	}
+
+	if err := m.InsertEntry(&Entry{Key: "a"}); err != nil {
+		t.Fatalf("insert entry: %v", err)
+	}
+	if sql := recorder.Last(); !strings.Contains(sql, "'a',NULL,") {
+		t.Errorf("statement %q doesn't store the empty name as NULL", sql)
+	}
+
+	if err := m.InsertEntry(&Entry{Key: "b", Name: "n"}); err != nil {
+		t.Fatalf("insert entry: %v", err)
+	}
+	if sql := recorder.Last(); !strings.Contains(sql, "'b','n',") {
+		t.Errorf("statement %q doesn't store the name", sql)
+	}
+
+	// dry run skips the insert and finds no entry with the key, as for a taken name
+	if _, err := m.ClaimKey("c", []byte(`1`)); !errors.Is(err, ErrNameTaken) {
+		t.Errorf("ClaimKey: err = %v, want ErrNameTaken", err)
+	}
+	if _, err := m.GetEntryByNameUnique(""); !errors.Is(err, ErrEntryNotFound) {
+		t.Errorf("GetEntryByNameUnique: err = %v, want ErrEntryNotFound", err)
+	}
+}
+
+func TestSaveEntryIgnoresID(t *testing.T) {
+	m, recorder := NewWithRecorder()
+
+	// the inserted columns, an ID among them would update entry 7 on a primary key conflict
+	insertedColumns := func() string {
+		sql := recorder.Last()
+		return sql[:strings.Index(sql, " VALUES")]
+	}
+
+	if err := m.SaveEntry(Entry{ID: 7, Key: "k", Value: []byte(`1`)}); err != nil {
+		t.Fatalf("save entry: %v", err)
+	}
+	if columns := insertedColumns(); strings.Contains(columns, "`id`") {
+		t.Errorf("SaveEntry inserts the ID: %q", columns)
+	}
+
+	if err := m.SaveEntries([]Entry{{ID: 7, Key: "k", Value: []byte(`1`)}}); err != nil {
+		t.Fatalf("save entries: %v", err)
+	}
+	if columns := insertedColumns(); strings.Contains(columns, "`id`") {
+		t.Errorf("SaveEntries inserts the ID: %q", columns)
+	}
+}
@@ -0,0 +1,207 @@
+package gormkeyvalue
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const eventBufferSize = 1024
+
+// EventHandler is notified about committed mutations, e.g. to invalidate peer caches.
+// OnSave is called for every write that changed an entry, also those that don't call
+// OnAfterSave hooks, OnDelete for every key removed from the store
+type EventHandler interface {
+	OnSave(e Entry)
+	OnDelete(key string)
+}
+
+type event struct {
+	entry   Entry
+	deleted bool
+}
+
+// eventDispatcher calls its handler from its own goroutine, so a slow handler
+// never blocks a query. Events that don't fit in the buffer are dropped
+type eventDispatcher struct {
+	handler EventHandler
+	events  chan event
+	dropped atomic.Int64
+	done    chan struct{}
+}
+
+func newEventDispatcher(h EventHandler) *eventDispatcher {
+	d := &eventDispatcher{
+		handler: h,
+		events:  make(chan event, eventBufferSize),
+		done:    make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+func (d *eventDispatcher) run() {
+	defer close(d.done)
+
+	for ev := range d.events {
+		if ev.deleted {
+			d.handler.OnDelete(ev.entry.Key)
+		} else {
+			d.handler.OnSave(ev.entry)
+		}
+	}
+}
+
+func (d *eventDispatcher) send(ev event) {
+	select {
+	case d.events <- ev:
+	default:
+		d.dropped.Add(1)
+	}
+}
+
+type eventHooks struct {
+	mu          sync.RWMutex
+	closed      bool
+	dispatchers []*eventDispatcher
+}
+
+func (h *eventHooks) add(handler EventHandler) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+	h.dispatchers = append(h.dispatchers, newEventDispatcher(handler))
+}
+
+func (h *eventHooks) hasHandlers() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return len(h.dispatchers) > 0
+}
+
+func (h *eventHooks) fire(ev event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.closed {
+		return
+	}
+	for _, d := range h.dispatchers {
+		d.send(ev)
+	}
+}
+
+func (h *eventHooks) fireDeleted(keys ...string) {
+	for _, key := range keys {
+		h.fire(event{entry: Entry{Key: key}, deleted: true})
+	}
+}
+
+func (h *eventHooks) dropped() int64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var n int64
+	for _, d := range h.dispatchers {
+		n += d.dropped.Load()
+	}
+	return n
+}
+
+// close delivers the buffered events and stops the dispatchers
+func (h *eventHooks) close() {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return
+	}
+	h.closed = true
+	dispatchers := h.dispatchers
+	h.mu.Unlock()
+
+	for _, d := range dispatchers {
+		close(d.events)
+		<-d.done
+	}
+}
+
+// AddEventHandler registers h for every committed save and delete. Events are
+// delivered in order from a goroutine per handler with a buffer of 1024;
+// when a handler falls that far behind further events are dropped, see DroppedEvents
+func (db *dbHandler) AddEventHandler(h EventHandler) {
+	db.hooks.events.add(h)
+}
+
+// DroppedEvents returns how many events were dropped for slow handlers
+func (db *dbHandler) DroppedEvents() int64 {
+	return db.hooks.events.dropped()
+}
+
+// fireSaved reads back the entries of keys changed server-side, e.g. by a JSON function,
+// and reports them to OnSave. It only queries when event handlers are registered
+func (db *dbHandler) fireSaved(keys ...string) {
+	if len(keys) == 0 || !db.hooks.events.hasHandlers() {
+		return
+	}
+
+	for _, chunk := range chunkSlice(keys, maxInClauseSize) {
+		entrys := []Entry{}
+		if err := db.gorm.Where("`key` IN ?", chunk).Find(&entrys).Error; err != nil {
+			// the write is committed, the key alone still invalidates a cache
+			for _, key := range chunk {
+				db.hooks.events.fire(event{entry: Entry{Key: key}})
+			}
+			continue
+		}
+
+		for _, e := range entrys {
+			db.hooks.events.fire(event{entry: e})
+		}
+	}
+}
+
+func (db *dbHandler) deleteEntryByID(id uint64) (int64, error) {
+	return db.deleteEntries(func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("id = ?", id)
+	})
+}
+
+// deleteEntries deletes the rows matched by where. With event handlers registered
+// it first locks and reads their keys in the same transaction to report them
+func (db *dbHandler) deleteEntries(where func(tx *gorm.DB) *gorm.DB) (int64, error) {
+	if !db.hooks.events.hasHandlers() {
+		result := where(db.gorm).Delete(&Entry{})
+		return result.RowsAffected, result.Error
+	}
+
+	var (
+		keys    []string
+		deleted int64
+	)
+	err := db.gorm.Transaction(func(tx *gorm.DB) error {
+		keys = nil
+		err := where(tx.Model(&Entry{})).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Pluck("key", &keys).Error
+		if err != nil {
+			return fmt.Errorf("read deleted keys: %w", err)
+		}
+
+		result := where(tx).Delete(&Entry{})
+		deleted = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	db.hooks.events.fireDeleted(keys...)
+	return deleted, nil
+}
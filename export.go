@@ -0,0 +1,147 @@
+package gormkeyvalue
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const exportBatchSize = 500
+
+var csvHeader = []string{"key", "name", "value_base64", "tags", "created_at", "updated_at"}
+
+// forEachEntry streams every entry ordered by id, loading exportBatchSize rows at a time
+func (db *dbHandler) forEachEntry(ctx context.Context, fn func(Entry) error) error {
+	batch := []Entry{}
+	result := db.gorm.WithContext(ctx).Model(&Entry{}).
+		FindInBatches(&batch, exportBatchSize, func(tx *gorm.DB, _ int) error {
+			for _, e := range batch {
+				if err := fn(e); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	return result.Error
+}
+
+// ExportCSV writes a header and one row per entry. Values are base64 encoded
+// so arbitrary bytes keep the output valid CSV, tags are a JSON array
+func (db *dbHandler) ExportCSV(ctx context.Context, w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return fmt.Errorf("write csv header: %w", err)
+	}
+
+	err := db.forEachEntry(ctx, func(e Entry) error {
+		tags := e.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		tagsJSON, err := json.Marshal(tags)
+		if err != nil {
+			return fmt.Errorf("encode tags of %q: %w", e.Key, err)
+		}
+
+		return writer.Write([]string{
+			e.Key,
+			e.Name,
+			base64.StdEncoding.EncodeToString(e.Value),
+			string(tagsJSON),
+			e.CreatedAt.Format(time.RFC3339Nano),
+			e.UpdatedAt.Format(time.RFC3339Nano),
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("export csv: %w", err)
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("export csv: %w", err)
+	}
+	return nil
+}
+
+// ExportJSONOptions configures ExportJSON
+type ExportJSONOptions struct {
+	// indent the output and embed values that are valid JSON as they are,
+	// for human-readable dumps. Other values stay base64 encoded
+	Pretty bool
+}
+
+type exportedEntry struct {
+	Key         string          `json:"key"`
+	Name        string          `json:"name"`
+	Value       json.RawMessage `json:"value,omitempty"`
+	ValueBase64 string          `json:"value_base64,omitempty"`
+	Tags        []string        `json:"tags,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// ExportJSON writes the entries as a JSON array. By default it is compact and
+// every value is base64 encoded, see ExportJSONOptions.Pretty
+func (db *dbHandler) ExportJSON(ctx context.Context, w io.Writer, opts ExportJSONOptions) error {
+	opening, separator, closing := []byte("["), []byte(","), []byte("]\n")
+	if opts.Pretty {
+		opening, separator, closing = []byte("[\n"), []byte(",\n"), []byte("\n]\n")
+	}
+
+	if _, err := w.Write(opening); err != nil {
+		return fmt.Errorf("export json: %w", err)
+	}
+
+	first := true
+	err := db.forEachEntry(ctx, func(e Entry) error {
+		item := exportedEntry{
+			Key:       e.Key,
+			Name:      e.Name,
+			Tags:      e.Tags,
+			CreatedAt: e.CreatedAt,
+			UpdatedAt: e.UpdatedAt,
+		}
+		if opts.Pretty && json.Valid(e.Value) {
+			item.Value = e.Value
+		} else {
+			item.ValueBase64 = base64.StdEncoding.EncodeToString(e.Value)
+		}
+
+		var (
+			data []byte
+			err  error
+		)
+		if opts.Pretty {
+			data, err = json.MarshalIndent(item, "", "  ")
+		} else {
+			data, err = json.Marshal(item)
+		}
+		if err != nil {
+			return err
+		}
+
+		if !first {
+			if _, err := w.Write(separator); err != nil {
+				return err
+			}
+		}
+		first = false
+
+		_, err = w.Write(data)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("export json: %w", err)
+	}
+
+	if _, err := w.Write(closing); err != nil {
+		return fmt.Errorf("export json: %w", err)
+	}
+	return nil
+}
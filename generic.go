@@ -0,0 +1,47 @@
+package gormkeyvalue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// GetEntryAs fetches the entry and decodes its JSON value into out
+func GetEntryAs[T any](m Memory, key string, out *T) error {
+	e, err := m.GetEntry(key)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrEntryNotFound
+		}
+		return fmt.Errorf("get entry: %w", err)
+	}
+
+	if err := json.Unmarshal(e.Value, out); err != nil {
+		return fmt.Errorf("decode entry %q: %w", key, err)
+	}
+	return nil
+}
+
+// GetEntriesAs fetches the keys and decodes each JSON value into T.
+// Missing keys are omitted, values that fail to decode are reported in
+// the second map by key instead of the result
+func GetEntriesAs[T any](m Memory, keys []string) (map[string]T, map[string]error, error) {
+	entries, err := m.GetEntriesByKeysConcurrent(keys, maxInClauseSize, 1)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get entries: %w", err)
+	}
+
+	result := make(map[string]T, len(entries))
+	failures := map[string]error{}
+	for key, e := range entries {
+		var v T
+		if err := json.Unmarshal(e.Value, &v); err != nil {
+			failures[key] = fmt.Errorf("decode entry %q: %w", key, err)
+			continue
+		}
+		result[key] = v
+	}
+	return result, failures, nil
+}
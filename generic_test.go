@@ -0,0 +1,82 @@
+package gormkeyvalue
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// stubMemory serves GetEntry from a map, every other method panics
+type stubMemory struct {
+	Memory
+	entries map[string]Entry
+}
+
+func (m *stubMemory) GetEntry(key string) (Entry, error) {
+	e, ok := m.entries[key]
+	if !ok {
+		return Entry{}, gorm.ErrRecordNotFound
+	}
+	return e, nil
+}
+
+type testAddress struct {
+	City string   `json:"city"`
+	Tags []string `json:"tags"`
+}
+
+type testProfile struct {
+	Name    string         `json:"name"`
+	Age     int            `json:"age"`
+	Address testAddress    `json:"address"`
+	Extra   map[string]int `json:"extra"`
+	Parent  *testProfile   `json:"parent"`
+}
+
+func TestGetEntryAsNestedStruct(t *testing.T) {
+	m := &stubMemory{entries: map[string]Entry{
+		"profile": {Key: "profile", Value: []byte(`{
+			"name": "child",
+			"age": 7,
+			"address": {"city": "Riga", "tags": ["home", "summer"]},
+			"extra": {"a": 1},
+			"parent": {"name": "parent", "age": 35, "address": {"city": "Oslo"}}
+		}`)},
+	}}
+
+	var got testProfile
+	if err := GetEntryAs(m, "profile", &got); err != nil {
+		t.Fatalf("GetEntryAs: %v", err)
+	}
+
+	want := testProfile{
+		Name:    "child",
+		Age:     7,
+		Address: testAddress{City: "Riga", Tags: []string{"home", "summer"}},
+		Extra:   map[string]int{"a": 1},
+		Parent:  &testProfile{Name: "parent", Age: 35, Address: testAddress{City: "Oslo"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetEntryAs = %+v, want %+v", got, want)
+	}
+}
+
+func TestGetEntryAsErrors(t *testing.T) {
+	m := &stubMemory{entries: map[string]Entry{
+		"broken":   {Key: "broken", Value: []byte(`{"name": `)},
+		"mismatch": {Key: "mismatch", Value: []byte(`{"address": "not an object"}`)},
+	}}
+
+	var out testProfile
+	if err := GetEntryAs(m, "missing", &out); !errors.Is(err, ErrEntryNotFound) {
+		t.Errorf("missing key: err = %v, want ErrEntryNotFound", err)
+	}
+	if err := GetEntryAs(m, "broken", &out); err == nil {
+		t.Error("invalid JSON: expected an error")
+	}
+	if err := GetEntryAs(m, "mismatch", &out); err == nil {
+		t.Error("nested type mismatch: expected an error")
+	}
+}
@@ -3,12 +3,15 @@ module github.com/Sagleft/gorm-key-value
 go 1.21.4
 
 require (
+	github.com/go-sql-driver/mysql v1.8.1
+	github.com/kelseyhightower/envconfig v1.4.0
+	github.com/santhosh-tekuri/jsonschema/v5 v5.3.1
 	gorm.io/driver/mysql v1.5.7
 	gorm.io/gorm v1.25.10
 )
 
 require (
-	github.com/go-sql-driver/mysql v1.7.0 // indirect
+	filippo.io/edwards25519 v1.1.0 // indirect
 	github.com/jinzhu/inflection v1.0.0 // indirect
 	github.com/jinzhu/now v1.1.5 // indirect
 )
@@ -0,0 +1,67 @@
+package gormkeyvalue
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+type HealthReport struct {
+	Reachable       bool
+	OpenConnections int
+	InUse           int
+	Idle            int
+	EntryCount      int64
+}
+
+// Health returns a filled report even when err is not nil,
+// e.g. the db is reachable but the count query timed out
+func (db *dbHandler) Health(ctx context.Context) (HealthReport, error) {
+	stats := db.conn.Stats()
+	report := HealthReport{
+		OpenConnections: stats.OpenConnections,
+		InUse:           stats.InUse,
+		Idle:            stats.Idle,
+	}
+
+	if err := db.conn.PingContext(ctx); err != nil {
+		return report, fmt.Errorf("ping db: %w", err)
+	}
+	report.Reachable = true
+
+	if err := db.gorm.WithContext(ctx).Model(&Entry{}).Count(&report.EntryCount).Error; err != nil {
+		return report, fmt.Errorf("count entries: %w", err)
+	}
+	return report, nil
+}
+
+// WarmPool opens and pings up to MaxIdleConns connections so the first requests
+// after startup don't pay the connect cost. It trades a slower startup for that.
+// It never waits for a busy pool: the count is bounded by the free capacity
+// of the pool, which for NewWithDB is configured by the caller
+func (db *dbHandler) WarmPool(ctx context.Context) error {
+	n := db.cfg.MaxIdleConns
+	if stats := db.conn.Stats(); stats.MaxOpenConnections > 0 && n > stats.MaxOpenConnections-stats.InUse {
+		n = stats.MaxOpenConnections - stats.InUse
+	}
+
+	conns := make([]*sql.Conn, 0, max(n, 0))
+	defer func() {
+		for _, c := range conns {
+			c.Close()
+		}
+	}()
+
+	for i := 0; i < n; i++ {
+		c, err := db.conn.Conn(ctx)
+		if err != nil {
+			return fmt.Errorf("warm pool: %w", err)
+		}
+		conns = append(conns, c)
+
+		if err := c.PingContext(ctx); err != nil {
+			return fmt.Errorf("warm pool: %w", err)
+		}
+	}
+	return nil
+}
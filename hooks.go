@@ -0,0 +1,137 @@
+package gormkeyvalue
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type entryHooks struct {
+	mu        sync.RWMutex
+	afterSave []func(Entry)
+
+	events eventHooks
+}
+
+func (h *entryHooks) addAfterSave(fn func(Entry)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.afterSave = append(h.afterSave, fn)
+}
+
+// hasListeners reports whether fireAfterSave reaches anyone, so callers can skip
+// reading back the saved entry
+func (h *entryHooks) hasListeners() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return len(h.afterSave) > 0 || h.events.hasHandlers()
+}
+
+func (h *entryHooks) fireAfterSave(e Entry) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, fn := range h.afterSave {
+		fn(e)
+	}
+	h.events.fire(event{entry: e})
+}
+
+// OnAfterSave registers fn to be called after an entry was successfully written.
+// It is not called for failed writes or rolled back transactions
+func (db *dbHandler) OnAfterSave(fn func(Entry)) {
+	db.hooks.addAfterSave(fn)
+}
+
+type queryHooks struct {
+	mu            sync.RWMutex
+	slowThreshold time.Duration
+	slowOrError   []func(op, sql string, dur time.Duration, err error)
+
+	lastErrMu sync.RWMutex
+	lastErr   error
+}
+
+func (h *queryHooks) setLastErr(err error) {
+	h.lastErrMu.Lock()
+	defer h.lastErrMu.Unlock()
+
+	h.lastErr = err
+}
+
+func (h *queryHooks) getLastErr() error {
+	h.lastErrMu.RLock()
+	defer h.lastErrMu.RUnlock()
+
+	return h.lastErr
+}
+
+func (h *queryHooks) addSlowOrError(fn func(op, sql string, dur time.Duration, err error)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.slowOrError = append(h.slowOrError, fn)
+}
+
+func (h *queryHooks) trace(begin time.Time, fc func() (string, int64), err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = nil
+	}
+	h.setLastErr(err)
+
+	dur := time.Since(begin)
+	if err == nil && dur < h.slowThreshold {
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if len(h.slowOrError) == 0 {
+		return
+	}
+
+	sql, _ := fc()
+	op := strings.ToUpper(strings.SplitN(strings.TrimSpace(sql), " ", 2)[0])
+	for _, fn := range h.slowOrError {
+		fn(op, sql, dur, err)
+	}
+}
+
+// OnSlowOrError registers fn to be called for every query that failed or
+// took longer than DBConfig.SlowQueryThresholdMS. It fires regardless of the gorm log level
+func (db *dbHandler) OnSlowOrError(fn func(op, sql string, dur time.Duration, err error)) {
+	db.queryHooks.addSlowOrError(fn)
+}
+
+// LastError returns the error of the most recent query, or nil when it succeeded.
+// It's a diagnostic for health endpoints, not a replacement for returned errors
+func (db *dbHandler) LastError() error {
+	return db.queryHooks.getLastErr()
+}
+
+type hookedLogger struct {
+	logger.Interface
+	hooks *queryHooks
+}
+
+func (l *hookedLogger) LogMode(level logger.LogLevel) logger.Interface {
+	return &hookedLogger{Interface: l.Interface.LogMode(level), hooks: l.hooks}
+}
+
+func (l *hookedLogger) Trace(
+	ctx context.Context,
+	begin time.Time,
+	fc func() (sql string, rowsAffected int64),
+	err error,
+) {
+	l.Interface.Trace(ctx, begin, fc, err)
+	l.hooks.trace(begin, fc, err)
+}
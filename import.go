@@ -0,0 +1,150 @@
+package gormkeyvalue
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ConflictPolicy decides what ImportEntries does with a key that already exists
+type ConflictPolicy int
+
+const (
+	// ConflictSkip keeps the stored entry
+	ConflictSkip ConflictPolicy = iota
+	// ConflictOverwrite replaces the stored name, value and tags
+	ConflictOverwrite
+	// ConflictNewer keeps whichever entry has the later UpdatedAt,
+	// for merging two stores that both evolved
+	ConflictNewer
+	// ConflictFail aborts the import with the duplicate key error
+	ConflictFail
+)
+
+func (p ConflictPolicy) onConflict() (clause.Expression, error) {
+	switch p {
+	case ConflictSkip:
+		return clause.OnConflict{Columns: []clause.Column{{Name: "key"}}, DoNothing: true}, nil
+	case ConflictOverwrite:
+		return clause.OnConflict{
+			Columns:   []clause.Column{{Name: "key"}},
+			DoUpdates: clause.AssignmentColumns([]string{"name", "value", "tags", "updated_at"}),
+		}, nil
+	case ConflictNewer:
+		// MySQL applies the assignments left to right, so updated_at goes last
+		// for name and value to compare against the stored timestamp
+		newer := "VALUES(updated_at) > updated_at"
+		return clause.OnConflict{
+			Columns: []clause.Column{{Name: "key"}},
+			DoUpdates: []clause.Assignment{
+				{Column: clause.Column{Name: "name"}, Value: gorm.Expr("IF(" + newer + ", VALUES(name), name)")},
+				{Column: clause.Column{Name: "value"}, Value: gorm.Expr("IF(" + newer + ", VALUES(`value`), `value`)")},
+				{Column: clause.Column{Name: "tags"}, Value: gorm.Expr("IF(" + newer + ", VALUES(tags), tags)")},
+				{Column: clause.Column{Name: "updated_at"}, Value: gorm.Expr("GREATEST(VALUES(updated_at), updated_at)")},
+			},
+		}, nil
+	case ConflictFail:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported conflict policy %d", p)
+	}
+}
+
+// ImportEntries writes entries keeping their timestamps, e.g. from another store,
+// and resolves existing keys by policy. Entries without timestamps get the current time.
+// With ConflictFail the statement containing a duplicate fails while earlier batches
+// stay imported. With UniqueName, ConflictOverwrite and ConflictNewer import entry by
+// entry in one transaction and fail with ErrNameTaken for a name owned by another key.
+// OnAfterSave hooks are not called
+func (db *dbHandler) ImportEntries(entries []Entry, policy ConflictPolicy) error {
+	err := db.importEntries(entries, policy)
+
+	// earlier batches may be imported even when it fails
+	db.fireSaved(entryKeys(entries)...)
+	return err
+}
+
+func entryKeys(entries []Entry) []string {
+	keys := make([]string, len(entries))
+	for i, e := range entries {
+		keys[i] = e.Key
+	}
+	return keys
+}
+
+func (db *dbHandler) importEntries(entries []Entry, policy ConflictPolicy) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	onConflict, err := policy.onConflict()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if err := db.validator.validate(e.Value); err != nil {
+			return fmt.Errorf("import entry %q: %w", e.Key, err)
+		}
+		if err := db.validateName(e.Name); err != nil {
+			return fmt.Errorf("import entry %q: %w", e.Key, err)
+		}
+	}
+
+	imported := make([]Entry, len(entries))
+	for i, e := range entries {
+		e.ID = 0
+		imported[i] = e
+	}
+
+	if db.cfg.UniqueName && (policy == ConflictOverwrite || policy == ConflictNewer) {
+		// see upsertOnKey, a batch upsert could overwrite entries owning the names
+		if err := db.importEach(imported, policy); err != nil {
+			return fmt.Errorf("import entries: %w", err)
+		}
+		return nil
+	}
+
+	tx := db.gorm
+	if onConflict != nil {
+		tx = tx.Clauses(onConflict)
+	}
+
+	if err := tx.CreateInBatches(&imported, exportBatchSize).Error; err != nil {
+		return fmt.Errorf("import entries: %w", err)
+	}
+	return nil
+}
+
+// importEach upserts the entries one by one with upsertOnKey,
+// with ConflictNewer leaving stored entries that are as new or newer
+func (db *dbHandler) importEach(entries []Entry, policy ConflictPolicy) error {
+	overwrite := clause.AssignmentColumns([]string{"name", "value", "tags", "updated_at"})
+	return db.gorm.Transaction(func(tx *gorm.DB) error {
+		for i := range entries {
+			e := &entries[i]
+			if e.UpdatedAt.IsZero() {
+				e.UpdatedAt = tx.NowFunc()
+			}
+
+			if policy == ConflictNewer {
+				var stored Entry
+				err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+					Select("updated_at").Where("`key` = ?", e.Key).Take(&stored).Error
+				if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+					return fmt.Errorf("entry %q: %w", e.Key, err)
+				}
+				if err == nil && !e.UpdatedAt.After(stored.UpdatedAt) {
+					continue
+				}
+			}
+
+			if err := db.upsertOnKey(tx, e, overwrite); err != nil {
+				return fmt.Errorf("entry %q: %w", e.Key, err)
+			}
+		}
+		return nil
+	})
+}
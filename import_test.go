@@ -0,0 +1,78 @@
+package gormkeyvalue
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// newUniqueNameRecorder returns a recorder store with UniqueName whose
+// transactions begin and whose reads find nothing
+func newUniqueNameRecorder(t *testing.T) (Memory, *SQLRecorder) {
+	m, recorder := NewWithRecorder()
+	db := m.(*dbHandler)
+	db.cfg.UniqueName = true
+	if err := db.applyModelOptions(); err != nil {
+		t.Fatalf("apply model options: %v", err)
+	}
+	db.gorm.ConnPool = dryRunTxPool{ConnPool: db.gorm.ConnPool}
+	db.gorm.Statement.ConnPool = db.gorm.ConnPool
+
+	err := db.gorm.Callback().Query().After("gorm:query").Register("test:not_found", func(tx *gorm.DB) {
+		if tx.Statement.RaiseErrorOnNotFound {
+			tx.AddError(gorm.ErrRecordNotFound)
+		}
+	})
+	if err != nil {
+		t.Fatalf("register not found callback: %v", err)
+	}
+	return m, recorder
+}
+
+func TestImportEntriesUniqueNameAvoidsBatchUpsert(t *testing.T) {
+	for _, policy := range []ConflictPolicy{ConflictOverwrite, ConflictNewer} {
+		m, recorder := newUniqueNameRecorder(t)
+
+		entries := []Entry{{Key: "a", Name: "n", Value: []byte(`1`)}, {Key: "b", Value: []byte(`2`)}}
+		if err := m.ImportEntries(entries, policy); err != nil {
+			t.Fatalf("policy %d: import entries: %v", policy, err)
+		}
+
+		inserts := 0
+		for _, sql := range recorder.Statements() {
+			if strings.Contains(sql, "ON DUPLICATE KEY UPDATE") {
+				t.Errorf("policy %d: %q would also update on a name taken by another key", policy, sql)
+			}
+			if strings.HasPrefix(sql, "INSERT") {
+				inserts++
+			}
+		}
+		if inserts != len(entries) {
+			t.Errorf("policy %d: %d inserts, want %d", policy, inserts, len(entries))
+		}
+	}
+}
+
+func TestRestoreUniqueNameAvoidsBatchUpsert(t *testing.T) {
+	m, recorder := newUniqueNameRecorder(t)
+
+	snapshot := `{"format":"gorm-key-value-snapshot","version":1,"rows":1}` + "\n" +
+		`{"key":"a","name":"n","value_base64":"MQ=="}` + "\n"
+	if err := m.Restore(context.Background(), bytes.NewBufferString(snapshot)); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+
+	inserted := false
+	for _, sql := range recorder.Statements() {
+		if strings.Contains(sql, "ON DUPLICATE KEY UPDATE") {
+			t.Errorf("%q would also update on a name taken by another key", sql)
+		}
+		inserted = inserted || strings.HasPrefix(sql, "INSERT")
+	}
+	if !inserted {
+		t.Error("restore inserted nothing")
+	}
+}
@@ -0,0 +1,61 @@
+package gormkeyvalue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrInvalidJSON = errors.New("invalid json")
+
+// MergePatchValue applies an RFC 7386 merge patch to the stored JSON value server-side.
+// With a value schema set, a patched value that doesn't match it is rolled back
+func (db *dbHandler) MergePatchValue(key string, patch []byte) error {
+	err := db.withWriteRetry(func() error {
+		return db.withValidatedWrite(key, func(tx *gorm.DB) error {
+			result := tx.Model(&Entry{}).Where("`key` = ?", key).
+				Update("value", gorm.Expr("JSON_MERGE_PATCH(`value`, ?)", string(patch)))
+			if result.Error == nil && result.RowsAffected == 0 {
+				return ErrEntryNotFound
+			}
+			return result.Error
+		})
+	})
+	if errors.Is(err, ErrEntryNotFound) {
+		return ErrEntryNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("merge patch value: %w", err)
+	}
+
+	db.fireSaved(key)
+	return nil
+}
+
+// AppendToJSONArray atomically appends element to the JSON array stored under key,
+// creating the entry with a single-element array when it is missing.
+// With a value schema set, an array that doesn't match it is rolled back
+func (db *dbHandler) AppendToJSONArray(key string, element []byte) error {
+	if !json.Valid(element) {
+		return ErrInvalidJSON
+	}
+
+	e := Entry{Key: key, Value: append(append([]byte("["), element...), ']')}
+	err := db.withWriteRetry(func() error {
+		return db.withValidatedWrite(key, func(tx *gorm.DB) error {
+			return db.upsertOnKey(tx, &e, clause.Assignments(map[string]interface{}{
+				"value":      gorm.Expr("JSON_ARRAY_APPEND(`value`, '$', CAST(? AS JSON))", string(element)),
+				"updated_at": tx.NowFunc(),
+			}))
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("append to json array: %w", err)
+	}
+
+	db.fireSaved(key)
+	return nil
+}
@@ -0,0 +1,118 @@
+package gormkeyvalue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const lockNamespace = "lock"
+
+type lockValue struct {
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Lock is an advisory, best-effort lock shared by every store using the same table.
+// It is not a fencing token: a holder that outlives ttl may lose the lock to another
+// acquirer without noticing.
+func (db *dbHandler) Lock(key string, ttl time.Duration) (func() error, bool, error) {
+	lockKey := NamespaceKey(lockNamespace, key)
+	if err := db.releaseExpiredLock(lockKey); err != nil {
+		return nil, false, fmt.Errorf("lock: %w", err)
+	}
+
+	value, err := json.Marshal(lockValue{ExpiresAt: db.gorm.NowFunc().Add(ttl)})
+	if err != nil {
+		return nil, false, fmt.Errorf("encode lock: %w", err)
+	}
+
+	e := Entry{Key: lockKey, Value: value}
+	acquired, err := db.createIfAbsent(&e)
+	if err != nil {
+		return nil, false, fmt.Errorf("lock: %w", err)
+	}
+	if !acquired {
+		return nil, false, nil
+	}
+
+	unlock := func() error {
+		// delete by id so an expired and reclaimed lock is left to its new holder
+		if _, err := db.deleteEntryByID(e.ID); err != nil {
+			return fmt.Errorf("unlock: %w", err)
+		}
+		return nil
+	}
+	return unlock, true, nil
+}
+
+func (db *dbHandler) releaseExpiredLock(lockKey string) error {
+	e := Entry{Key: lockKey}
+	if err := db.gorm.Model(&Entry{}).Where(&e).First(&e).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("get lock: %w", err)
+	}
+
+	expiresAt, err := getLockExpiration(e)
+	if err != nil {
+		return err
+	}
+	if db.gorm.NowFunc().Before(expiresAt) {
+		return nil
+	}
+
+	if _, err := db.deleteEntryByID(e.ID); err != nil {
+		return fmt.Errorf("delete expired lock: %w", err)
+	}
+	return nil
+}
+
+func getLockExpiration(e Entry) (time.Time, error) {
+	var v lockValue
+	if err := json.Unmarshal(e.Value, &v); err != nil {
+		return time.Time{}, fmt.Errorf("decode lock %q: %w", e.Key, err)
+	}
+	return v.ExpiresAt, nil
+}
+
+func (db *dbHandler) ListLocks() ([]Entry, error) {
+	locks := []Entry{}
+	if err := whereKeyPrefix(db.gorm, namespacePrefix(lockNamespace)).Order("id ASC").Find(&locks).Error; err != nil {
+		return nil, fmt.Errorf("list locks: %w", err)
+	}
+	return locks, nil
+}
+
+func (db *dbHandler) PurgeExpiredLocks() (int64, error) {
+	locks, err := db.ListLocks()
+	if err != nil {
+		return 0, err
+	}
+
+	now := db.gorm.NowFunc()
+	expiredIDs := []uint64{}
+	for _, lock := range locks {
+		expiresAt, err := getLockExpiration(lock)
+		if err != nil {
+			return 0, err
+		}
+		if !now.Before(expiresAt) {
+			expiredIDs = append(expiredIDs, lock.ID)
+		}
+	}
+	if len(expiredIDs) == 0 {
+		return 0, nil
+	}
+
+	deleted, err := db.deleteEntries(func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("id IN ?", expiredIDs)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("purge expired locks: %w", err)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,170 @@
+package gormkeyvalue
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrUnsupportedDialect = errors.New("operation is not supported by the database dialect")
+
+const (
+	KeepNewest = "newest"
+	KeepOldest = "oldest"
+)
+
+type TimestampColumn string
+
+const (
+	CreatedAtColumn TimestampColumn = "created_at"
+	UpdatedAtColumn TimestampColumn = "updated_at"
+)
+
+func (c TimestampColumn) validate() error {
+	if c != CreatedAtColumn && c != UpdatedAtColumn {
+		return fmt.Errorf("unsupported timestamp column %q", string(c))
+	}
+	return nil
+}
+
+// SetTimestamps overwrites created_at and updated_at of the entry,
+// bypassing gorm's auto-update of updated_at
+func (db *dbHandler) SetTimestamps(key string, createdAt, updatedAt time.Time) error {
+	result := db.gorm.Model(&Entry{}).Where("`key` = ?", key).UpdateColumns(map[string]interface{}{
+		"created_at": createdAt,
+		"updated_at": updatedAt,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("set timestamps: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrEntryNotFound
+	}
+
+	db.fireSaved(key)
+	return nil
+}
+
+// Optimize reclaims space and defragments the managed tables.
+// On MySQL it runs OPTIMIZE TABLE, which may lock the table while it rebuilds
+func (db *dbHandler) Optimize() error {
+	var statement string
+	switch db.gorm.Dialector.Name() {
+	case "mysql":
+		statement = "OPTIMIZE TABLE ?"
+	case "postgres":
+		statement = "VACUUM ?"
+	default:
+		return fmt.Errorf("optimize %s: %w", db.gorm.Dialector.Name(), ErrUnsupportedDialect)
+	}
+
+	for _, table := range db.ManagedTables() {
+		if err := withoutQueryTimeout(db.gorm).Exec(statement, clause.Table{Name: table}).Error; err != nil {
+			return fmt.Errorf("optimize %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+func (db *dbHandler) DeleteEntriesOlderThan(t time.Time, column TimestampColumn) (int64, error) {
+	if err := column.validate(); err != nil {
+		return 0, err
+	}
+
+	deleted, err := db.deleteEntries(func(tx *gorm.DB) *gorm.DB {
+		return tx.Where(string(column)+" < ?", t)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("delete entries older than: %w", err)
+	}
+	return deleted, nil
+}
+
+// CountEntriesOlderThan is the dry run of DeleteEntriesOlderThan
+func (db *dbHandler) CountEntriesOlderThan(t time.Time, column TimestampColumn) (int64, error) {
+	if err := column.validate(); err != nil {
+		return 0, err
+	}
+
+	var count int64
+	if err := db.gorm.Model(&Entry{}).Where(string(column)+" < ?", t).Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("count entries older than: %w", err)
+	}
+	return count, nil
+}
+
+// FindDuplicateKeys reports keys stored more than once with their row count.
+// Tables created before key became unique may hold such duplicates,
+// which must be removed before the unique index can be added: until then the
+// migration fails with ErrDuplicateKeys. A store opened with SkipIndexMigration
+// starts anyway, to run this and DedupeKeys on
+func (db *dbHandler) FindDuplicateKeys() (map[string]int64, error) {
+	rows := []struct {
+		Key   string
+		Count int64
+	}{}
+	err := db.gorm.Model(&Entry{}).
+		Select("`key`, COUNT(*) AS count").
+		Group("`key`").
+		Having("COUNT(*) > 1").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("find duplicate keys: %w", err)
+	}
+
+	result := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		result[row.Key] = row.Count
+	}
+	return result, nil
+}
+
+// DedupeKeys keeps one row per key, the latest inserted (KeepNewest) or the first (KeepOldest)
+// by id, and deletes the others. Run FindDuplicateKeys first to review what goes away
+func (db *dbHandler) DedupeKeys(keep string) (int64, error) {
+	var condition string
+	switch keep {
+	case KeepNewest:
+		condition = "other.id > e.id"
+	case KeepOldest:
+		condition = "other.id < e.id"
+	default:
+		return 0, fmt.Errorf("unsupported dedupe mode %q", keep)
+	}
+
+	if db.gorm.Dialector.Name() != "mysql" {
+		return 0, fmt.Errorf("dedupe keys %s: %w", db.gorm.Dialector.Name(), ErrUnsupportedDialect)
+	}
+
+	s, err := db.parseModel(&Entry{})
+	if err != nil {
+		return 0, fmt.Errorf("dedupe keys: %w", err)
+	}
+
+	// the kept row of each key is reported as saved
+	var duplicates map[string]int64
+	if db.hooks.events.hasHandlers() {
+		if duplicates, err = db.FindDuplicateKeys(); err != nil {
+			return 0, fmt.Errorf("dedupe keys: %w", err)
+		}
+	}
+
+	result := db.gorm.Exec(
+		"DELETE e FROM ? JOIN ? ON other.`key` = e.`key` AND "+condition,
+		clause.Table{Name: s.Table, Alias: "e"},
+		clause.Table{Name: s.Table, Alias: "other"},
+	)
+	if result.Error != nil {
+		return 0, fmt.Errorf("dedupe keys: %w", result.Error)
+	}
+
+	keys := make([]string, 0, len(duplicates))
+	for key := range duplicates {
+		keys = append(keys, key)
+	}
+	db.fireSaved(keys...)
+	return result.RowsAffected, nil
+}
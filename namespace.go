@@ -0,0 +1,101 @@
+package gormkeyvalue
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const namespaceSeparator = ":"
+
+var (
+	ErrEmptyNamespace = errors.New("namespace must not be empty")
+	ErrEmptyPrefix    = errors.New("prefix must not be empty")
+	ErrKeyCollision   = errors.New("renamed keys collide with existing keys")
+)
+
+// NamespaceKey builds the key of an entry inside the namespace, e.g. "tenant:key"
+func NamespaceKey(ns, key string) string {
+	return namespacePrefix(ns) + key
+}
+
+func namespacePrefix(ns string) string {
+	return ns + namespaceSeparator
+}
+
+func whereKeyPrefix(tx *gorm.DB, prefix string) *gorm.DB {
+	return tx.Where("`key` LIKE ? ESCAPE ?", EscapeLike(prefix)+"%", likeEscape)
+}
+
+func (db *dbHandler) DeleteNamespace(ns string) (int64, error) {
+	if ns == "" {
+		return 0, ErrEmptyNamespace
+	}
+
+	deleted, err := db.deleteEntries(func(tx *gorm.DB) *gorm.DB {
+		return whereKeyPrefix(tx, namespacePrefix(ns))
+	})
+	if err != nil {
+		return 0, fmt.Errorf("delete namespace: %w", err)
+	}
+	return deleted, nil
+}
+
+// RekeyPrefix renames every key starting with oldPrefix to start with newPrefix
+// in one statement. Nothing is renamed when a new key already exists
+func (db *dbHandler) RekeyPrefix(oldPrefix, newPrefix string) (int64, error) {
+	if oldPrefix == "" {
+		return 0, ErrEmptyPrefix
+	}
+
+	pattern := EscapeLike(oldPrefix) + "%"
+	prefixLen := utf8.RuneCountInString(oldPrefix)
+	newKey := gorm.Expr("CONCAT(?, SUBSTRING(`key`, ?))", newPrefix, prefixLen+1)
+
+	var (
+		renamed int64
+		oldKeys []string
+	)
+	err := db.gorm.Transaction(func(tx *gorm.DB) error {
+		var collisions int64
+		err := tx.Model(&Entry{}).
+			Where("`key` IN (?)", tx.Model(&Entry{}).Select("?", newKey).Where("`key` LIKE ? ESCAPE ?", pattern, likeEscape)).
+			Count(&collisions).Error
+		if err != nil {
+			return err
+		}
+		if collisions > 0 {
+			return ErrKeyCollision
+		}
+
+		if db.hooks.events.hasHandlers() {
+			oldKeys = nil
+			err := tx.Model(&Entry{}).
+				Where("`key` LIKE ? ESCAPE ?", pattern, likeEscape).
+				Clauses(clause.Locking{Strength: "UPDATE"}).
+				Pluck("key", &oldKeys).Error
+			if err != nil {
+				return fmt.Errorf("read renamed keys: %w", err)
+			}
+		}
+
+		result := tx.Model(&Entry{}).Where("`key` LIKE ? ESCAPE ?", pattern, likeEscape).Update("key", newKey)
+		renamed = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		return 0, fmt.Errorf("rekey prefix: %w", err)
+	}
+
+	// the entries are gone under their old keys and saved under the new ones
+	newKeys := make([]string, len(oldKeys))
+	for i, key := range oldKeys {
+		newKeys[i] = newPrefix + string([]rune(key)[prefixLen:])
+	}
+	db.hooks.events.fireDeleted(oldKeys...)
+	db.fireSaved(newKeys...)
+	return renamed, nil
+}
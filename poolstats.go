@@ -0,0 +1,71 @@
+package gormkeyvalue
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// poolWaitCollector samples the pool stats on an interval and reports how many
+// connection requests had to wait, and for how long, since the previous sample
+type poolWaitCollector struct {
+	mu  sync.RWMutex
+	fns []func(waitCount int64, waitDuration time.Duration)
+
+	stopOnce sync.Once
+	stop     chan struct{}
+}
+
+func newPoolWaitCollector(conn *sql.DB, interval time.Duration) *poolWaitCollector {
+	c := &poolWaitCollector{stop: make(chan struct{})}
+	if interval > 0 {
+		go c.run(conn, interval)
+	}
+	return c
+}
+
+func (c *poolWaitCollector) run(conn *sql.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	prev := conn.Stats()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+
+		stats := conn.Stats()
+		c.report(stats.WaitCount-prev.WaitCount, stats.WaitDuration-prev.WaitDuration)
+		prev = stats
+	}
+}
+
+func (c *poolWaitCollector) report(waitCount int64, waitDuration time.Duration) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, fn := range c.fns {
+		fn(waitCount, waitDuration)
+	}
+}
+
+func (c *poolWaitCollector) add(fn func(waitCount int64, waitDuration time.Duration)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.fns = append(c.fns, fn)
+}
+
+func (c *poolWaitCollector) close() {
+	c.stopOnce.Do(func() { close(c.stop) })
+}
+
+// OnPoolWait registers fn to receive, every DBConfig.PoolStatsIntervalMS, the number of
+// connection requests that waited for a free connection and their total wait since the
+// previous call. Steady non-zero values mean the pool is too small for the load.
+// It is never called when the interval is 0
+func (db *dbHandler) OnPoolWait(fn func(waitCount int64, waitDuration time.Duration)) {
+	db.poolWait.add(fn)
+}
@@ -0,0 +1,206 @@
+package gormkeyvalue
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	maxQueryLimit   = 1000
+	maxLikePatterns = 50
+)
+
+var (
+	ErrInvalidLimit = errors.New("limit must be greater than zero")
+	ErrNotSelect    = errors.New("only a single SELECT statement is allowed")
+
+	ErrTooManyPatterns = fmt.Errorf("at most %d patterns are allowed", maxLikePatterns)
+)
+
+var projectableColumns = map[string]bool{
+	"id":         true,
+	"created_at": true,
+	"updated_at": true,
+	"key":        true,
+	"name":       true,
+	"value":      true,
+	"tags":       true,
+}
+
+var likeReplacer = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// likeEscape is bound as the ESCAPE character of every pattern built with EscapeLike,
+// since backslash is not the default escape of every driver or sql_mode
+const likeEscape = `\`
+
+// EscapeLike escapes %, _ and the backslash escape character so s is matched
+// literally inside a LIKE pattern, e.g. NameLike(EscapeLike(input) + "%").
+// The result relies on backslash as the escape character. Queries of this package bind it
+// with ESCAPE, but NameLike and the other raw pattern methods use the server default,
+// which isn't backslash under MySQL's NO_BACKSLASH_ESCAPES or in every database.
+// Callers must add the same ESCAPE to SQL of their own, e.g. in RawQueryEntries
+func EscapeLike(s string) string {
+	return likeReplacer.Replace(s)
+}
+
+func normalizeLimit(limit int) (int, error) {
+	if limit <= 0 {
+		return 0, ErrInvalidLimit
+	}
+	if limit > maxQueryLimit {
+		return maxQueryLimit, nil
+	}
+	return limit, nil
+}
+
+// EntryQuery accumulates parameterized conditions into a single query
+type EntryQuery struct {
+	tx    *gorm.DB
+	limit int
+	err   error
+}
+
+func (db *dbHandler) Query() *EntryQuery {
+	return &EntryQuery{tx: db.gorm.Model(&Entry{})}
+}
+
+func (q *EntryQuery) NameEquals(name string) *EntryQuery {
+	q.tx = q.tx.Where("name = ?", name)
+	return q
+}
+
+func (q *EntryQuery) NameLike(pattern string) *EntryQuery {
+	q.tx = q.tx.Where("name LIKE ?", pattern)
+	return q
+}
+
+// NameLikeAny matches names like any of the patterns. No patterns match nothing
+func (q *EntryQuery) NameLikeAny(patterns ...string) *EntryQuery {
+	if len(patterns) > maxLikePatterns {
+		q.err = ErrTooManyPatterns
+		return q
+	}
+	if len(patterns) == 0 {
+		q.tx = q.tx.Where("1 = 0")
+		return q
+	}
+
+	conditions := q.tx.Session(&gorm.Session{NewDB: true})
+	for _, pattern := range patterns {
+		conditions = conditions.Or("name LIKE ?", pattern)
+	}
+	q.tx = q.tx.Where(conditions)
+	return q
+}
+
+func (q *EntryQuery) NameNotLike(pattern string) *EntryQuery {
+	q.tx = q.tx.Where("name NOT LIKE ?", pattern)
+	return q
+}
+
+func (q *EntryQuery) KeyPrefix(prefix string) *EntryQuery {
+	q.tx = q.tx.Where("`key` LIKE ? ESCAPE ?", EscapeLike(prefix)+"%", likeEscape)
+	return q
+}
+
+func (q *EntryQuery) CreatedAfter(t time.Time) *EntryQuery {
+	q.tx = q.tx.Where("created_at > ?", t)
+	return q
+}
+
+func (q *EntryQuery) CreatedBefore(t time.Time) *EntryQuery {
+	q.tx = q.tx.Where("created_at < ?", t)
+	return q
+}
+
+func (q *EntryQuery) UpdatedAfter(t time.Time) *EntryQuery {
+	q.tx = q.tx.Where("updated_at > ?", t)
+	return q
+}
+
+// JSONPathEquals matches entries whose value has the given JSON path, e.g. "$.user.id"
+func (q *EntryQuery) JSONPathEquals(path string, value interface{}) *EntryQuery {
+	q.tx = q.tx.Where("JSON_EXTRACT(`value`, ?) = ?", path, value)
+	return q
+}
+
+// Fields loads only the given columns, e.g. "key", "name", "updated_at" to skip large values
+func (q *EntryQuery) Fields(fields ...string) *EntryQuery {
+	for _, field := range fields {
+		if !projectableColumns[field] {
+			q.err = fmt.Errorf("unknown entry column %q", field)
+			return q
+		}
+	}
+
+	q.tx = q.tx.Select(fields)
+	return q
+}
+
+func (q *EntryQuery) Limit(limit int) *EntryQuery {
+	limit, err := normalizeLimit(limit)
+	if err != nil {
+		q.err = err
+	}
+	q.limit = limit
+	return q
+}
+
+func (q *EntryQuery) Find() ([]Entry, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+
+	tx := q.tx.Order("id ASC")
+	if q.limit > 0 {
+		tx = tx.Limit(q.limit)
+	}
+
+	entrys := []Entry{}
+	if err := tx.Find(&entrys).Error; err != nil {
+		return nil, fmt.Errorf("find entries: %w", err)
+	}
+	return entrys, nil
+}
+
+func isSingleSelect(statement string) bool {
+	statement = strings.TrimSuffix(strings.TrimSpace(statement), ";")
+	if strings.Contains(statement, ";") {
+		return false
+	}
+
+	fields := strings.Fields(strings.ToUpper(statement))
+	if len(fields) == 0 || fields[0] != "SELECT" {
+		return false
+	}
+	for _, field := range fields {
+		if field == "INTO" || field == "FOR" {
+			return false
+		}
+	}
+	return true
+}
+
+// RawQueryEntries runs a custom SELECT and scans the rows into entries.
+// Values must be passed as args with ? placeholders, never formatted into the statement.
+// Anything but a single SELECT is rejected with ErrNotSelect and the query runs
+// in a read-only transaction
+func (db *dbHandler) RawQueryEntries(statement string, args ...interface{}) ([]Entry, error) {
+	if !isSingleSelect(statement) {
+		return nil, ErrNotSelect
+	}
+
+	entrys := []Entry{}
+	err := db.gorm.Transaction(func(tx *gorm.DB) error {
+		return tx.Raw(statement, args...).Scan(&entrys).Error
+	}, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("raw query entries: %w", err)
+	}
+	return entrys, nil
+}
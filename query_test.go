@@ -0,0 +1,49 @@
+package gormkeyvalue
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEscapeLike(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "abc", "abc"},
+		{"empty", "", ""},
+		{"percent", "100%", `100\%`},
+		{"underscore", "a_b", `a\_b`},
+		{"backslash", `a\b`, `a\\b`},
+		{"every metacharacter", `%_\`, `\%\_\\`},
+		{"already escaped", `a\%b\_c`, `a\\\%b\\\_c`},
+		{"unicode", "ключ_%", `ключ\_\%`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EscapeLike(tt.in); got != tt.want {
+				t.Errorf("EscapeLike(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEscapeLikeBindsEscapeCharacter(t *testing.T) {
+	m, recorder := NewWithRecorder()
+
+	if _, err := m.Query().KeyPrefix("a%b").Find(); err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	if sql := recorder.Last(); !strings.Contains(sql, `LIKE 'a\%b%' ESCAPE '\'`) {
+		t.Errorf("KeyPrefix statement %q lacks the escaped pattern and ESCAPE", sql)
+	}
+
+	recorder.Reset()
+	if _, err := m.ListLocks(); err != nil {
+		t.Fatalf("list locks: %v", err)
+	}
+	if sql := recorder.Last(); !strings.Contains(sql, `ESCAPE '\'`) {
+		t.Errorf("ListLocks statement %q lacks ESCAPE", sql)
+	}
+}
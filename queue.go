@@ -0,0 +1,61 @@
+package gormkeyvalue
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PopEntry reads and deletes the entry in one transaction,
+// so only one of several concurrent callers gets it
+func (db *dbHandler) PopEntry(key string) (Entry, error) {
+	var e Entry
+	err := db.gorm.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Model(&Entry{}).Where("`key` = ?", key).First(&e).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Delete(&Entry{}, e.ID).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Entry{}, ErrEntryNotFound
+		}
+		return Entry{}, fmt.Errorf("pop entry: %w", err)
+	}
+
+	db.hooks.events.fireDeleted(e.Key)
+	return e, nil
+}
+
+// PopAnyByNamePrefix pops the oldest entry whose name starts with prefix.
+// Rows locked by other workers are skipped, so it needs MySQL 8.0+ for SKIP LOCKED.
+// The bool is false when there was nothing to pop
+func (db *dbHandler) PopAnyByNamePrefix(prefix string) (Entry, bool, error) {
+	var e Entry
+	err := db.gorm.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Model(&Entry{}).
+			Where("name LIKE ? ESCAPE ?", EscapeLike(prefix)+"%", likeEscape).
+			Order("created_at ASC").Order("id ASC").
+			Take(&e).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Delete(&Entry{}, e.ID).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Entry{}, false, nil
+		}
+		return Entry{}, false, fmt.Errorf("pop any by name prefix: %w", err)
+	}
+
+	db.hooks.events.fireDeleted(e.Key)
+	return e, true, nil
+}
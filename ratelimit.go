@@ -0,0 +1,89 @@
+package gormkeyvalue
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const rateLimitNamespace = "ratelimit"
+
+var ErrInvalidWindow = errors.New("window must be greater than zero")
+
+// RateLimiter is a fixed-window limiter shared by every store using the same table.
+// Each key gets one counter row per window, so up to 2*limit calls can pass around
+// a window boundary. A sliding window would smooth that out at the cost of a row per call
+type RateLimiter struct {
+	memory Memory
+}
+
+func NewRateLimiter(m Memory) *RateLimiter {
+	return &RateLimiter{memory: m}
+}
+
+// Allow counts the call against the current window of key and reports
+// whether it is within limit and how many calls are left in the window
+func (r *RateLimiter) Allow(key string, limit int, window time.Duration) (bool, int, error) {
+	if limit <= 0 {
+		return false, 0, ErrInvalidLimit
+	}
+	if window <= 0 {
+		return false, 0, ErrInvalidWindow
+	}
+
+	windowIndex := r.memory.GormDB().NowFunc().UnixNano() / int64(window)
+	baseKey := NamespaceKey(rateLimitNamespace, key)
+	windowKey := NamespaceKey(baseKey, strconv.FormatInt(windowIndex, 10))
+
+	count, err := r.memory.IncrementEntry(windowKey, 1)
+	if err != nil {
+		return false, 0, fmt.Errorf("rate limit: %w", err)
+	}
+
+	if count == 1 {
+		// first call in a new window, drop the counters of the expired ones
+		if err := r.purgeWindows(baseKey, windowKey); err != nil {
+			return false, 0, fmt.Errorf("rate limit: %w", err)
+		}
+	}
+
+	remaining := int64(limit) - count
+	if remaining < 0 {
+		remaining = 0
+	}
+	return count <= int64(limit), int(remaining), nil
+}
+
+func (r *RateLimiter) purgeWindows(baseKey, currentKey string) error {
+	entrys, err := r.memory.Query().
+		KeyPrefix(baseKey+namespaceSeparator).
+		Fields("id", "key").
+		Limit(maxQueryLimit).
+		Find()
+	if err != nil {
+		return fmt.Errorf("find expired windows: %w", err)
+	}
+
+	ids := []uint64{}
+	for _, e := range entrys {
+		if e.Key == currentKey {
+			continue
+		}
+		// skip windows of other keys sharing the prefix, e.g. "a:b" for "a"
+		suffix := strings.TrimPrefix(e.Key, baseKey+namespaceSeparator)
+		if _, err := strconv.ParseInt(suffix, 10, 64); err != nil {
+			continue
+		}
+		ids = append(ids, e.ID)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if _, err := r.memory.DeleteEntriesByIDs(ids); err != nil {
+		return fmt.Errorf("delete expired windows: %w", err)
+	}
+	return nil
+}
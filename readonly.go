@@ -0,0 +1,34 @@
+package gormkeyvalue
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+const readOnlyCallbackName = "gormkeyvalue:read_only"
+
+var ErrReadOnly = errors.New("store is read-only")
+
+// registerReadOnly fails every create, update, delete and Exec statement with
+// ErrReadOnly before it is sent, so no write method can slip through
+func registerReadOnly(conn *gorm.DB) error {
+	reject := func(tx *gorm.DB) {
+		tx.AddError(ErrReadOnly)
+	}
+
+	callbacks := conn.Callback()
+	registrations := []func() error{
+		func() error { return callbacks.Create().Before("*").Register(readOnlyCallbackName, reject) },
+		func() error { return callbacks.Update().Before("*").Register(readOnlyCallbackName, reject) },
+		func() error { return callbacks.Delete().Before("*").Register(readOnlyCallbackName, reject) },
+		func() error { return callbacks.Raw().Before("*").Register(readOnlyCallbackName, reject) },
+	}
+	for _, register := range registrations {
+		if err := register(); err != nil {
+			return fmt.Errorf("register read-only mode: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package gormkeyvalue
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// dryRunTxPool lets transactions of a recorder store begin and commit without a server
+type dryRunTxPool struct {
+	gorm.ConnPool
+}
+
+func (p dryRunTxPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	return p, nil
+}
+
+func (p dryRunTxPool) Commit() error   { return nil }
+func (p dryRunTxPool) Rollback() error { return nil }
+
+func TestReadOnlyRejectsEveryWrite(t *testing.T) {
+	m, _ := NewWithRecorder()
+	db := m.(*dbHandler)
+	if err := registerReadOnly(db.gorm); err != nil {
+		t.Fatalf("register read-only mode: %v", err)
+	}
+	db.gorm.ConnPool = dryRunTxPool{ConnPool: db.gorm.ConnPool}
+	db.gorm.Statement.ConnPool = db.gorm.ConnPool
+
+	// dry run reads find a zero entry, missing makes them find nothing instead
+	var missing bool
+	err := db.gorm.Callback().Query().After("gorm:query").Register("test:not_found", func(tx *gorm.DB) {
+		if missing && tx.Statement.RaiseErrorOnNotFound {
+			tx.AddError(gorm.ErrRecordNotFound)
+		}
+	})
+	if err != nil {
+		t.Fatalf("register not found callback: %v", err)
+	}
+
+	e := Entry{Key: "key", Name: "name", Value: []byte(`{"a":1}`)}
+	now := time.Now()
+	snapshot := `{"format":"gorm-key-value-snapshot","version":1,"rows":1}` + "\n" +
+		`{"key":"key","name":"name","value_base64":"eyJhIjoxfQ=="}` + "\n"
+
+	// PurgeExpiredLocks is left out: dry run finds no lock to delete,
+	// its delete is the one of DeleteEntriesByIDs
+	tests := []struct {
+		name    string
+		missing bool
+		write   func() error
+	}{
+		{"SaveEntry", false, func() error { return m.SaveEntry(e) }},
+		{"SaveEntryMerge", false, func() error { return m.SaveEntryMerge(e) }},
+		{"SaveKV", false, func() error { return m.SaveKV("key", []byte(`1`)) }},
+		{"SaveAndGet", false, func() error { _, err := m.SaveAndGet(e); return err }},
+		{"InsertEntry", false, func() error { return m.InsertEntry(&Entry{Key: "key"}) }},
+		{"SaveEntries", false, func() error { return m.SaveEntries([]Entry{e}) }},
+		{"SaveEntriesBatched", false, func() error { return m.SaveEntriesBatched([]Entry{e}, 10) }},
+		{"SaveEntriesPartial", false, func() error {
+			_, failures, err := m.SaveEntriesPartial([]Entry{e})
+			if errors.Is(err, ErrAllEntriesFailed) {
+				return failures[0]
+			}
+			return err
+		}},
+		{"ImportEntries", false, func() error { return m.ImportEntries([]Entry{e}, ConflictOverwrite) }},
+		{"Restore", false, func() error { return m.Restore(context.Background(), bytes.NewBufferString(snapshot)) }},
+		{"SetValueIfUnchanged", false, func() error {
+			_, err := m.SetValueIfUnchanged("key", []byte(`1`), []byte(`2`))
+			return err
+		}},
+		{"SaveEntryIfAbsent", false, func() error { _, err := m.SaveEntryIfAbsent(e); return err }},
+		{"ClaimKey", false, func() error { _, err := m.ClaimKey("key", []byte(`1`)); return err }},
+		{"GetOrGenerate", true, func() error {
+			_, err := m.GetOrGenerate("key", func() ([]byte, error) { return []byte(`1`), nil })
+			return err
+		}},
+		{"Lock", true, func() error { _, _, err := m.Lock("key", time.Minute); return err }},
+		{"MergePatchValue", false, func() error { return m.MergePatchValue("key", []byte(`{"b":2}`)) }},
+		{"AppendToJSONArray", false, func() error { return m.AppendToJSONArray("key", []byte(`1`)) }},
+		{"IncrementEntry", false, func() error { _, err := m.IncrementEntry("key", 1); return err }},
+		{"SetTimestamps", false, func() error { return m.SetTimestamps("key", now, now) }},
+		{"TouchEntries", false, func() error { _, err := m.TouchEntries([]string{"key"}); return err }},
+		{"AddTag", false, func() error { return m.AddTag("key", "tag") }},
+		{"RemoveTag", false, func() error { return m.RemoveTag("key", "tag") }},
+		{"PopEntry", false, func() error { _, err := m.PopEntry("key"); return err }},
+		{"PopAnyByNamePrefix", false, func() error { _, _, err := m.PopAnyByNamePrefix("name"); return err }},
+		{"DeleteEntriesByIDs", false, func() error { _, err := m.DeleteEntriesByIDs([]uint64{1}); return err }},
+		{"DeleteEntriesOlderThan", false, func() error {
+			_, err := m.DeleteEntriesOlderThan(now, CreatedAtColumn)
+			return err
+		}},
+		{"DeleteNamespace", false, func() error { _, err := m.DeleteNamespace("ns"); return err }},
+		{"RekeyPrefix", false, func() error { _, err := m.RekeyPrefix("a:", "b:"); return err }},
+		{"DedupeKeys", false, func() error { _, err := m.DedupeKeys(KeepNewest); return err }},
+		{"Optimize", false, func() error { return m.Optimize() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			missing = tt.missing
+			if err := tt.write(); !errors.Is(err, ErrReadOnly) {
+				t.Errorf("err = %v, want ErrReadOnly", err)
+			}
+		})
+	}
+}
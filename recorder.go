@@ -0,0 +1,114 @@
+package gormkeyvalue
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// SQLRecorder captures the SQL statements built by a store from NewWithRecorder
+type SQLRecorder struct {
+	mu         sync.Mutex
+	statements []string
+}
+
+func (r *SQLRecorder) record(sql string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.statements = append(r.statements, sql)
+}
+
+// Statements returns the recorded SQL with the args interpolated, oldest first
+func (r *SQLRecorder) Statements() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string{}, r.statements...)
+}
+
+// Last returns the most recent statement or "" when nothing was recorded
+func (r *SQLRecorder) Last() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.statements) == 0 {
+		return ""
+	}
+	return r.statements[len(r.statements)-1]
+}
+
+func (r *SQLRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.statements = nil
+}
+
+type recordingLogger struct {
+	logger.Interface
+	recorder *SQLRecorder
+}
+
+func (l *recordingLogger) LogMode(level logger.LogLevel) logger.Interface {
+	return &recordingLogger{Interface: l.Interface.LogMode(level), recorder: l.recorder}
+}
+
+func (l *recordingLogger) Trace(
+	ctx context.Context,
+	begin time.Time,
+	fc func() (sql string, rowsAffected int64),
+	err error,
+) {
+	sql, _ := fc()
+	l.recorder.record(sql)
+	l.Interface.Trace(ctx, begin, fc, err)
+}
+
+// NewWithRecorder returns a store for tests that asserts on the generated MySQL
+// without a server: statements are built in gorm's dry run mode and recorded,
+// never executed. Reads therefore find nothing, and no migration runs. Methods that
+// open a transaction fail, as BEGIN still needs a server.
+// It panics if gorm can't be initialized
+func NewWithRecorder() (Memory, *SQLRecorder) {
+	cfg := DBConfig{}
+	recorder := &SQLRecorder{}
+	queryHooks := getQueryHooks(cfg)
+
+	gormConfig := newGormConfig(cfg, queryHooks)
+	gormConfig.DryRun = true
+	gormConfig.DisableAutomaticPing = true
+	gormConfig.Logger = &recordingLogger{
+		Interface: gormConfig.Logger.LogMode(logger.Silent),
+		recorder:  recorder,
+	}
+
+	gormConn, err := gorm.Open(mysql.New(mysql.Config{SkipInitializeWithVersion: true}), gormConfig)
+	if err != nil {
+		panic(err)
+	}
+	conn, err := gormConn.DB()
+	if err != nil {
+		panic(err)
+	}
+
+	handler := &dbHandler{
+		cfg:             cfg,
+		conn:            conn,
+		ownsConn:        true,
+		gorm:            gormConn,
+		ownsStmtCache:   true,
+		prefixViews:     newPrefixViews(),
+		valueColumnType: ValueColumnJSON,
+
+		hooks:      &entryHooks{},
+		queryHooks: queryHooks,
+		poolWait:   newPoolWaitCollector(conn, 0),
+		validator:  &valueValidator{},
+	}
+	return handler, recorder
+}
@@ -0,0 +1,42 @@
+package gormkeyvalue
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+
+	gomysql "github.com/go-sql-driver/mysql"
+)
+
+const (
+	mysqlErrDuplicateEntry  = 1062
+	mysqlErrLockWaitTimeout = 1205
+	mysqlErrDeadlock        = 1213
+
+	deadlockRetryDelay = time.Millisecond * 10
+)
+
+func isDeadlockErr(err error) bool {
+	var mysqlErr *gomysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+	return mysqlErr.Number == mysqlErrDeadlock || mysqlErr.Number == mysqlErrLockWaitTimeout
+}
+
+func isDuplicateEntryErr(err error) bool {
+	var mysqlErr *gomysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrDuplicateEntry
+}
+
+// withWriteRetry retries the write when mysql reports a deadlock or a lock wait timeout
+func (db *dbHandler) withWriteRetry(write func() error) error {
+	err := write()
+	for attempt := 1; attempt <= db.deadlockRetries && isDeadlockErr(err); attempt++ {
+		jitter := time.Duration(rand.Int63n(int64(deadlockRetryDelay)))
+		time.Sleep(deadlockRetryDelay*time.Duration(attempt) + jitter)
+
+		err = write()
+	}
+	return err
+}
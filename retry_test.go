@@ -0,0 +1,71 @@
+package gormkeyvalue
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	gomysql "github.com/go-sql-driver/mysql"
+)
+
+func TestIsDeadlockErr(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"deadlock", &gomysql.MySQLError{Number: mysqlErrDeadlock}, true},
+		{"lock wait timeout", &gomysql.MySQLError{Number: mysqlErrLockWaitTimeout}, true},
+		{"wrapped deadlock", fmt.Errorf("save entry: %w", &gomysql.MySQLError{Number: mysqlErrDeadlock}), true},
+		{"duplicate entry", &gomysql.MySQLError{Number: mysqlErrDuplicateEntry}, false},
+		{"other error", errors.New("deadlock"), false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isDeadlockErr(tt.err); got != tt.want {
+				t.Errorf("isDeadlockErr(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithWriteRetry(t *testing.T) {
+	deadlock := &gomysql.MySQLError{Number: mysqlErrDeadlock, Message: "Deadlock found when trying to get lock"}
+	otherErr := errors.New("syntax error")
+
+	tests := []struct {
+		name      string
+		retries   int
+		failures  []error
+		wantCalls int
+		wantErr   error
+	}{
+		{"succeeds at once", 3, nil, 1, nil},
+		{"succeeds after deadlocks", 3, []error{deadlock, deadlock}, 3, nil},
+		{"gives up after the retries", 2, []error{deadlock, deadlock, deadlock, deadlock}, 3, deadlock},
+		{"no retries configured", 0, []error{deadlock}, 1, deadlock},
+		{"other errors are not retried", 3, []error{otherErr}, 1, otherErr},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &dbHandler{deadlockRetries: tt.retries}
+
+			calls := 0
+			err := db.withWriteRetry(func() error {
+				calls++
+				if calls <= len(tt.failures) {
+					return tt.failures[calls-1]
+				}
+				return nil
+			})
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("write called %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
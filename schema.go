@@ -0,0 +1,508 @@
+package gormkeyvalue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	ValueColumnJSON     = "json"
+	ValueColumnLongText = "longtext"
+	ValueColumnLongBlob = "longblob"
+
+	uniqueNameIndex = "idx_name_unique"
+	// named apart from the non-unique idx_entries_key of older tables,
+	// which AutoMigrate would otherwise take for this index
+	uniqueKeyIndex = "idx_entries_key_unique"
+)
+
+// MigrationMode controls what the startup migration may change
+type MigrationMode string
+
+const (
+	// MigrationAlter runs gorm's AutoMigrate, which also alters existing columns
+	MigrationAlter MigrationMode = "alter"
+	// MigrationSafe only creates missing tables, columns and indexes
+	MigrationSafe MigrationMode = "safe"
+	// MigrationFailOnDrift creates missing tables but refuses to start with
+	// ErrSchemaDrift when an existing table differs from the model
+	MigrationFailOnDrift MigrationMode = "fail_on_drift"
+)
+
+var (
+	ErrSchemaDrift   = errors.New("schema differs from the model")
+	ErrDuplicateKeys = errors.New("keys are stored more than once")
+)
+
+func (m MigrationMode) validate() error {
+	switch m {
+	case "", MigrationAlter, MigrationSafe, MigrationFailOnDrift:
+		return nil
+	default:
+		return fmt.Errorf("unsupported migration mode %q", string(m))
+	}
+}
+
+type schemaIssue struct {
+	description string
+	isTable     bool
+	isIndex     bool
+	// repairing alters an existing column
+	isAlter bool
+	repair  func() error
+}
+
+func getTableOptions(cfg DBConfig) string {
+	options := []string{}
+	if cfg.TableEngine != "" {
+		options = append(options, "ENGINE="+cfg.TableEngine)
+	}
+	if cfg.TableRowFormat != "" {
+		options = append(options, "ROW_FORMAT="+cfg.TableRowFormat)
+	}
+	if cfg.TableCharset != "" {
+		options = append(options, "DEFAULT CHARSET="+cfg.TableCharset)
+	}
+	if cfg.TableComment != "" {
+		comment := strings.NewReplacer(`\`, `\\`, "'", "''").Replace(cfg.TableComment)
+		options = append(options, "COMMENT='"+comment+"'")
+	}
+	return strings.Join(options, " ")
+}
+
+// tableOptionPattern matches engine, row format and charset names,
+// which are pasted into the DDL unquoted
+var tableOptionPattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+func validateTableOptions(cfg DBConfig) error {
+	options := []struct{ name, value string }{
+		{"table engine", cfg.TableEngine},
+		{"table row format", cfg.TableRowFormat},
+		{"table charset", cfg.TableCharset},
+	}
+	for _, option := range options {
+		if option.value != "" && !tableOptionPattern.MatchString(option.value) {
+			return fmt.Errorf("%s %q is not a plain name", option.name, option.value)
+		}
+	}
+	return nil
+}
+
+func getValueColumnType(cfg DBConfig) (string, error) {
+	switch strings.ToLower(cfg.ValueColumnType) {
+	case "", ValueColumnJSON:
+		return ValueColumnJSON, nil
+	case ValueColumnLongText:
+		return ValueColumnLongText, nil
+	case ValueColumnLongBlob:
+		return ValueColumnLongBlob, nil
+	default:
+		return "", fmt.Errorf("unsupported value column type %q", cfg.ValueColumnType)
+	}
+}
+
+// applyModelOptions adjusts the cached Entry schema to the config: it overrides
+// the `type:json` tags of Value and Tags, the column comments and adds the optional unique index on Name.
+// It is safe to call more than once
+func (db *dbHandler) applyModelOptions() error {
+	s, err := db.parseModel(&Entry{})
+	if err != nil {
+		return err
+	}
+
+	if db.valueColumnType != ValueColumnJSON {
+		field := s.LookUpField("Value")
+		if field == nil {
+			return fmt.Errorf("value field not found in %s", s.Table)
+		}
+		field.DataType = schema.DataType(db.valueColumnType)
+
+		// JSON functions also accept JSON text, so tags only need a text column
+		tags := s.LookUpField("Tags")
+		if tags == nil {
+			return fmt.Errorf("tags field not found in %s", s.Table)
+		}
+		tags.DataType = schema.DataType(ValueColumnLongText)
+	}
+
+	for column, comment := range db.cfg.ColumnComments {
+		field := s.LookUpField(column)
+		if field == nil {
+			return fmt.Errorf("column %s not found in %s", column, s.Table)
+		}
+		field.Comment = comment
+	}
+
+	if db.cfg.UniqueName {
+		field := s.LookUpField("Name")
+		if field == nil {
+			return fmt.Errorf("name field not found in %s", s.Table)
+		}
+		uniqueTag := reflect.StructTag(`gorm:"index;uniqueIndex:` + uniqueNameIndex + `"`)
+		if field.Tag != uniqueTag {
+			field.Tag = uniqueTag
+			storeEmptyAsNull(field)
+		}
+	}
+	return nil
+}
+
+// storeEmptyAsNull writes an empty string field as NULL, which the unique index
+// on it doesn't cover, so any number of entries can go without a name.
+// NULL reads back as the empty string
+func storeEmptyAsNull(field *schema.Field) {
+	valueOf := field.ValueOf
+	field.ValueOf = func(ctx context.Context, v reflect.Value) (interface{}, bool) {
+		value, zero := valueOf(ctx, v)
+		if s, ok := value.(string); ok && s == "" {
+			return nil, true
+		}
+		return value, zero
+	}
+}
+
+// nullEmptyNames moves the empty names of an existing table to NULL
+// before the unique name index is added, as they would collide in it
+func (db *dbHandler) nullEmptyNames() error {
+	migrator := db.migrationDB().Migrator()
+	if !migrator.HasTable(&Entry{}) || migrator.HasIndex(&Entry{}, uniqueNameIndex) {
+		return nil
+	}
+
+	err := db.migrationDB().Model(&Entry{}).Where("name = ?", "").UpdateColumn("name", nil).Error
+	if err != nil {
+		return fmt.Errorf("store empty names as null: %w", err)
+	}
+	return nil
+}
+
+func (db *dbHandler) migrationDB() *gorm.DB {
+	tx := withoutQueryTimeout(db.gorm)
+	if db.tableOptions == "" {
+		return tx
+	}
+	return tx.Set("gorm:table_options", db.tableOptions)
+}
+
+func (db *dbHandler) migrate() error {
+	if err := db.applyModelOptions(); err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+
+	if db.cfg.UniqueName && db.cfg.MigrationMode != MigrationFailOnDrift && !db.skipIndexMigration {
+		if err := db.nullEmptyNames(); err != nil {
+			return fmt.Errorf("migrate: %w", err)
+		}
+	}
+
+	switch db.cfg.MigrationMode {
+	case MigrationSafe:
+		return db.migrateSafe()
+	case MigrationFailOnDrift:
+		return db.migrateOrFailOnDrift()
+	}
+
+	if db.skipIndexMigration {
+		return db.migrateWithoutIndexes()
+	}
+
+	migrator := db.migrationDB().Migrator()
+	if migrator.HasTable(&Entry{}) && !migrator.HasIndex(&Entry{}, uniqueKeyIndex) {
+		if err := db.requireUniqueKeys(); err != nil {
+			return fmt.Errorf("migrate: %w", err)
+		}
+	}
+
+	for _, prefab := range models {
+		if err := db.migrationDB().AutoMigrate(prefab); err != nil {
+			return fmt.Errorf("migrate: %w", err)
+		}
+	}
+	return nil
+}
+
+// requireUniqueKeys fails while the table holds duplicate keys, which tables
+// created before the key index was unique may do, as the unique index can't be added
+func (db *dbHandler) requireUniqueKeys() error {
+	// a full scan, exempt from the query timeout like the migration itself
+	view := *db
+	view.gorm = withoutQueryTimeout(db.gorm)
+	duplicates, err := view.FindDuplicateKeys()
+	if err != nil {
+		return err
+	}
+	if len(duplicates) > 0 {
+		return fmt.Errorf(
+			"%w: %d keys, open the store with SkipIndexMigration to review them with "+
+				"FindDuplicateKeys and remove them with DedupeKeys, then reopen it without",
+			ErrDuplicateKeys, len(duplicates),
+		)
+	}
+	return nil
+}
+
+func (db *dbHandler) migrateWithConfig(migrationCfg, cfg DBConfig) error {
+	conn, err := openConnection(migrationCfg)
+	if err != nil {
+		return fmt.Errorf("migration connection: %w", err)
+	}
+	defer conn.Close()
+
+	gormConn, err := openGorm(conn, cfg, db.queryHooks)
+	if err != nil {
+		return fmt.Errorf("migration connection: %w", err)
+	}
+
+	migrationHandler := *db
+	migrationHandler.conn = conn
+	migrationHandler.gorm = gormConn
+	return migrationHandler.migrate()
+}
+
+// migrateWithoutIndexes creates missing tables and adds missing columns only.
+// A new table still gets its indexes inline since that is free on an empty table
+func (db *dbHandler) migrateWithoutIndexes() error {
+	issues, err := db.findSchemaIssues()
+	if err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+
+	for _, issue := range issues {
+		if issue.isIndex || issue.isAlter {
+			continue
+		}
+		if err := issue.repair(); err != nil {
+			return fmt.Errorf("migrate: %s: %w", issue.description, err)
+		}
+	}
+	return nil
+}
+
+// migrateSafe creates what is missing and never alters existing columns
+func (db *dbHandler) migrateSafe() error {
+	if db.skipIndexMigration {
+		return db.migrateWithoutIndexes()
+	}
+
+	issues, err := db.findSchemaIssues()
+	if err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+
+	for _, issue := range issues {
+		if issue.isAlter {
+			continue
+		}
+		if err := issue.repair(); err != nil {
+			return fmt.Errorf("migrate: %s: %w", issue.description, err)
+		}
+	}
+	return nil
+}
+
+// migrateOrFailOnDrift creates missing tables and fails on any other difference
+func (db *dbHandler) migrateOrFailOnDrift() error {
+	issues, err := db.findSchemaIssues()
+	if err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+
+	drift := []string{}
+	for _, issue := range issues {
+		if issue.isTable {
+			continue
+		}
+		drift = append(drift, issue.description)
+	}
+	if len(drift) > 0 {
+		return fmt.Errorf("migrate: %w: %s", ErrSchemaDrift, strings.Join(drift, "; "))
+	}
+
+	for _, issue := range issues {
+		if err := issue.repair(); err != nil {
+			return fmt.Errorf("migrate: %s: %w", issue.description, err)
+		}
+	}
+	return nil
+}
+
+func (db *dbHandler) parseModel(model interface{}) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: db.gorm}
+	if err := stmt.Parse(model); err != nil {
+		return nil, fmt.Errorf("parse model: %w", err)
+	}
+	return stmt.Schema, nil
+}
+
+func (db *dbHandler) findSchemaIssues() ([]schemaIssue, error) {
+	if err := db.applyModelOptions(); err != nil {
+		return nil, err
+	}
+
+	migrator := db.migrationDB().Migrator()
+	issues := []schemaIssue{}
+
+	for _, prefab := range models {
+		prefab := prefab
+
+		s, err := db.parseModel(prefab)
+		if err != nil {
+			return nil, err
+		}
+
+		if !migrator.HasTable(prefab) {
+			issues = append(issues, schemaIssue{
+				description: fmt.Sprintf("table %s is missing", s.Table),
+				isTable:     true,
+				repair:      func() error { return migrator.CreateTable(prefab) },
+			})
+			continue
+		}
+
+		columnTypes, err := migrator.ColumnTypes(prefab)
+		if err != nil {
+			return nil, fmt.Errorf("read columns of %s: %w", s.Table, err)
+		}
+		existingTypes := map[string]string{}
+		for _, columnType := range columnTypes {
+			existingTypes[columnType.Name()] = strings.ToLower(columnType.DatabaseTypeName())
+		}
+
+		for _, field := range s.Fields {
+			if field.DBName == "" {
+				continue
+			}
+
+			fieldName := field.Name
+			existingType, ok := existingTypes[field.DBName]
+			if !ok {
+				issues = append(issues, schemaIssue{
+					description: fmt.Sprintf("column %s.%s is missing", s.Table, field.DBName),
+					repair:      func() error { return migrator.AddColumn(prefab, fieldName) },
+				})
+				continue
+			}
+
+			expectedType := baseColumnType(migrator.FullDataTypeOf(field).SQL)
+			if existingType != expectedType {
+				issues = append(issues, schemaIssue{
+					description: fmt.Sprintf(
+						"column %s.%s is %s, expected %s", s.Table, field.DBName, existingType, expectedType,
+					),
+					isAlter: true,
+					repair:  func() error { return migrator.AlterColumn(prefab, fieldName) },
+				})
+			}
+		}
+
+		existingIndexes, err := migrator.GetIndexes(prefab)
+		if err != nil {
+			return nil, fmt.Errorf("read indexes of %s: %w", s.Table, err)
+		}
+		existingUnique := map[string]bool{}
+		for _, index := range existingIndexes {
+			unique, _ := index.Unique()
+			existingUnique[index.Name()] = unique
+		}
+
+		indexes := s.ParseIndexes()
+		indexNames := []string{}
+		for name := range indexes {
+			indexNames = append(indexNames, name)
+		}
+		sort.Strings(indexNames)
+
+		for _, name := range indexNames {
+			indexName := name
+			create := func(replace bool) func() error {
+				return func() error {
+					if indexName == uniqueKeyIndex {
+						if err := db.requireUniqueKeys(); err != nil {
+							return err
+						}
+					}
+					if replace {
+						if err := migrator.DropIndex(prefab, indexName); err != nil {
+							return err
+						}
+					}
+					return migrator.CreateIndex(prefab, indexName)
+				}
+			}
+
+			unique, ok := existingUnique[name]
+			switch {
+			case !ok:
+				issues = append(issues, schemaIssue{
+					description: fmt.Sprintf("index %s on %s is missing", name, s.Table),
+					isIndex:     true,
+					repair:      create(false),
+				})
+			case indexes[name].Class == "UNIQUE" && !unique:
+				issues = append(issues, schemaIssue{
+					description: fmt.Sprintf("index %s on %s is not unique", name, s.Table),
+					isIndex:     true,
+					repair:      create(true),
+				})
+			}
+		}
+	}
+	return issues, nil
+}
+
+// baseColumnType strips size and modifiers, e.g. "bigint unsigned NOT NULL" and "varchar(191)"
+// become "bigint" and "varchar" to compare with the type reported by the server
+func baseColumnType(dataType string) string {
+	dataType = strings.ToLower(dataType)
+	if i := strings.IndexAny(dataType, "( "); i >= 0 {
+		dataType = dataType[:i]
+	}
+	return dataType
+}
+
+func (db *dbHandler) VerifySchema() ([]string, error) {
+	issues, err := db.findSchemaIssues()
+	if err != nil {
+		return nil, fmt.Errorf("verify schema: %w", err)
+	}
+
+	result := make([]string, 0, len(issues))
+	for _, issue := range issues {
+		result = append(result, issue.description)
+	}
+	return result, nil
+}
+
+func (db *dbHandler) RepairSchema() error {
+	issues, err := db.findSchemaIssues()
+	if err != nil {
+		return fmt.Errorf("repair schema: %w", err)
+	}
+
+	for _, issue := range issues {
+		if err := issue.repair(); err != nil {
+			return fmt.Errorf("repair schema: %s: %w", issue.description, err)
+		}
+	}
+	return nil
+}
+
+func (db *dbHandler) ManagedTables() []string {
+	tables := make([]string, 0, len(models))
+	for _, prefab := range models {
+		s, err := db.parseModel(prefab)
+		if err != nil {
+			continue
+		}
+		tables = append(tables, s.Table)
+	}
+	return tables
+}
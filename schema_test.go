@@ -0,0 +1,42 @@
+package gormkeyvalue
+
+import "testing"
+
+func TestGetTableOptionsEscapesComment(t *testing.T) {
+	tests := []struct {
+		comment string
+		want    string
+	}{
+		{"entries", `COMMENT='entries'`},
+		{"it's", `COMMENT='it''s'`},
+		{`ends with \`, `COMMENT='ends with \\'`},
+		{`\'`, `COMMENT='\\'''`},
+	}
+	for _, tt := range tests {
+		if got := getTableOptions(DBConfig{TableComment: tt.comment}); got != tt.want {
+			t.Errorf("comment %q: options = %q, want %q", tt.comment, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTableOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     DBConfig
+		wantErr bool
+	}{
+		{"none", DBConfig{}, false},
+		{"plain names", DBConfig{TableEngine: "InnoDB", TableRowFormat: "DYNAMIC", TableCharset: "utf8mb4"}, false},
+		{"engine with a statement", DBConfig{TableEngine: "InnoDB; DROP TABLE users"}, true},
+		{"row format with a space", DBConfig{TableRowFormat: "DYNAMIC COMMENT='x'"}, true},
+		{"charset with a quote", DBConfig{TableCharset: "utf8'"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTableOptions(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
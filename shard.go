@@ -0,0 +1,16 @@
+package gormkeyvalue
+
+import "hash/fnv"
+
+// ShardFor maps key to a shard index in [0, shards) with 32-bit FNV-1a.
+// The placement only depends on the key bytes and shards, so it is stable across
+// processes and releases. Changing shards moves most keys. Returns 0 when shards < 1
+func ShardFor(key string, shards int) int {
+	if shards < 1 {
+		return 0
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(shards))
+}
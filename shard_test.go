@@ -0,0 +1,49 @@
+package gormkeyvalue
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestShardForIsStable(t *testing.T) {
+	// placements must never change between releases, the data lives in these shards
+	tests := []struct {
+		key    string
+		shards int
+		want   int
+	}{
+		{"", 16, 5},
+		{"a", 16, 12},
+		{"user:42", 16, 2},
+		{"user:42", 7, 1},
+		{"ключ", 10, 3},
+	}
+	for _, tt := range tests {
+		if got := ShardFor(tt.key, tt.shards); got != tt.want {
+			t.Errorf("ShardFor(%q, %d) = %d, want %d", tt.key, tt.shards, got, tt.want)
+		}
+	}
+}
+
+func TestShardForRange(t *testing.T) {
+	for _, shards := range []int{1, 2, 3, 16, 1000} {
+		for i := 0; i < 1000; i++ {
+			key := fmt.Sprintf("key-%d", i)
+			got := ShardFor(key, shards)
+			if got < 0 || got >= shards {
+				t.Fatalf("ShardFor(%q, %d) = %d, out of range", key, shards, got)
+			}
+			if again := ShardFor(key, shards); again != got {
+				t.Fatalf("ShardFor(%q, %d) = %d then %d", key, shards, got, again)
+			}
+		}
+	}
+}
+
+func TestShardForWithoutShards(t *testing.T) {
+	for _, shards := range []int{0, -1} {
+		if got := ShardFor("key", shards); got != 0 {
+			t.Errorf("ShardFor(key, %d) = %d, want 0", shards, got)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package gormkeyvalue
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"gorm.io/gorm"
+)
+
+const (
+	snapshotFormat  = "gorm-key-value-snapshot"
+	snapshotVersion = 1
+)
+
+var ErrInvalidSnapshot = errors.New("invalid snapshot")
+
+type snapshotHeader struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	Rows    int64  `json:"rows"`
+}
+
+// Snapshot writes every entry as JSON lines: a header with the format version and
+// row count, then one entry per line. It reads from a single consistent snapshot
+// of the table, so the count matches the rows even under concurrent writes
+func (db *dbHandler) Snapshot(ctx context.Context, w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	err := db.gorm.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		header := snapshotHeader{Format: snapshotFormat, Version: snapshotVersion}
+		if err := tx.Model(&Entry{}).Count(&header.Rows).Error; err != nil {
+			return fmt.Errorf("count entries: %w", err)
+		}
+		if err := encoder.Encode(header); err != nil {
+			return fmt.Errorf("write header: %w", err)
+		}
+
+		view := *db
+		view.gorm = tx
+		return view.forEachEntry(ctx, func(e Entry) error {
+			return encoder.Encode(exportedEntry{
+				Key:         e.Key,
+				Name:        e.Name,
+				ValueBase64: base64.StdEncoding.EncodeToString(e.Value),
+				Tags:        e.Tags,
+				CreatedAt:   e.CreatedAt,
+				UpdatedAt:   e.UpdatedAt,
+			})
+		})
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("snapshot: %w", err)
+	}
+	return nil
+}
+
+// Restore loads a Snapshot, overwriting entries with the same key, one transaction
+// per batch. A failed or truncated restore leaves the batches loaded before it
+// in place and returns ErrInvalidSnapshot when the row count doesn't match the header.
+// With UniqueName a name owned by another key fails its batch with ErrNameTaken
+// instead of overwriting that entry
+func (db *dbHandler) Restore(ctx context.Context, r io.Reader) error {
+	decoder := json.NewDecoder(r)
+
+	var header snapshotHeader
+	if err := decoder.Decode(&header); err != nil {
+		return fmt.Errorf("restore: read header: %w", err)
+	}
+	if header.Format != snapshotFormat || header.Version != snapshotVersion {
+		return fmt.Errorf("restore: %w: unsupported format %q version %d", ErrInvalidSnapshot, header.Format, header.Version)
+	}
+
+	var rows int64
+	batch := make([]Entry, 0, exportBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := db.gorm.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			view := *db
+			view.gorm = tx
+			return view.importEntries(batch, ConflictOverwrite)
+		})
+		if err == nil {
+			db.fireSaved(entryKeys(batch)...)
+		}
+		batch = batch[:0]
+		return err
+	}
+
+	for {
+		var item exportedEntry
+		if err := decoder.Decode(&item); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return fmt.Errorf("restore: %w: row %d: %v", ErrInvalidSnapshot, rows+1, err)
+		}
+
+		value, err := base64.StdEncoding.DecodeString(item.ValueBase64)
+		if err != nil {
+			return fmt.Errorf("restore: %w: row %d: %v", ErrInvalidSnapshot, rows+1, err)
+		}
+
+		batch = append(batch, Entry{
+			Key:       item.Key,
+			Name:      item.Name,
+			Value:     value,
+			Tags:      item.Tags,
+			CreatedAt: item.CreatedAt,
+			UpdatedAt: item.UpdatedAt,
+		})
+		rows++
+
+		if len(batch) == exportBatchSize {
+			if err := flush(); err != nil {
+				return fmt.Errorf("restore: %w", err)
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	if rows != header.Rows {
+		return fmt.Errorf("restore: %w: header has %d rows, read %d", ErrInvalidSnapshot, header.Rows, rows)
+	}
+	return nil
+}
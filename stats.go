@@ -0,0 +1,123 @@
+package gormkeyvalue
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoBuckets      = errors.New("at least one bucket edge is required")
+	ErrNegativeBucket = errors.New("bucket edges must not be negative")
+)
+
+// ValueSizeHistogram counts values by byte length. Every count is keyed by the
+// lower edge of its bucket, so edges [0, 1024, 65536] give [0, 1024), [1024, 65536)
+// and [65536, ...). A 0 edge is added when missing, negative edges are rejected
+func (db *dbHandler) ValueSizeHistogram(buckets []int) (map[int]int64, error) {
+	if len(buckets) == 0 {
+		return nil, ErrNoBuckets
+	}
+
+	edges := append([]int{}, buckets...)
+	sort.Ints(edges)
+	if edges[0] < 0 {
+		return nil, fmt.Errorf("%w: %d", ErrNegativeBucket, edges[0])
+	}
+	if edges[0] != 0 {
+		edges = append([]int{0}, edges...)
+	}
+
+	var caseExpr strings.Builder
+	args := []interface{}{}
+	caseExpr.WriteString("CASE")
+	for i := 1; i < len(edges); i++ {
+		caseExpr.WriteString(" WHEN COALESCE(LENGTH(`value`), 0) < ? THEN ?")
+		args = append(args, edges[i], edges[i-1])
+	}
+	caseExpr.WriteString(" ELSE ? END")
+	args = append(args, edges[len(edges)-1])
+
+	rows := []struct {
+		Bucket int
+		Total  int64
+	}{}
+	err := db.gorm.Model(&Entry{}).
+		Select(caseExpr.String()+" AS bucket, COUNT(*) AS total", args...).
+		Group("bucket").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("value size histogram: %w", err)
+	}
+
+	histogram := make(map[int]int64, len(edges))
+	for _, edge := range edges {
+		histogram[edge] = 0
+	}
+	for _, row := range rows {
+		histogram[row.Bucket] = row.Total
+	}
+	return histogram, nil
+}
+
+func (db *dbHandler) CountEntriesGroupedByName() (map[string]int64, error) {
+	rows := []struct {
+		Name  string
+		Total int64
+	}{}
+	err := db.gorm.Model(&Entry{}).
+		Select("name, COUNT(*) AS total").
+		Group("name").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("count entries grouped by name: %w", err)
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Name] = row.Total
+	}
+	return counts, nil
+}
+
+// CountEntriesByDay counts entries created in [from, to) per day, keyed by "2006-01-02".
+// Days follow the configured Location, using its UTC offset at from
+func (db *dbHandler) CountEntriesByDay(from, to time.Time) (map[string]int64, error) {
+	loc, err := time.LoadLocation(db.cfg.Location)
+	if err != nil {
+		return nil, fmt.Errorf("load location: %w", err)
+	}
+
+	rows := []struct {
+		Day   string
+		Total int64
+	}{}
+	err = db.gorm.Model(&Entry{}).
+		Select("DATE_FORMAT(CONVERT_TZ(created_at, '+00:00', ?), '%Y-%m-%d') AS day, COUNT(*) AS total",
+			formatUTCOffset(from.In(loc))).
+		Where("created_at >= ? AND created_at < ?", from, to).
+		Group("day").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("count entries by day: %w", err)
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Day] = row.Total
+	}
+	return counts, nil
+}
+
+func formatUTCOffset(t time.Time) string {
+	_, offset := t.Zone()
+
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	return fmt.Sprintf("%s%02d:%02d", sign, offset/3600, offset%3600/60)
+}
@@ -0,0 +1,18 @@
+package gormkeyvalue
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValueSizeHistogramRejectsEdges(t *testing.T) {
+	m, _ := NewWithRecorder()
+
+	if _, err := m.ValueSizeHistogram(nil); !errors.Is(err, ErrNoBuckets) {
+		t.Errorf("no edges: err = %v, want ErrNoBuckets", err)
+	}
+	// a prepended 0 would put -5 into an unsorted CASE chain
+	if _, err := m.ValueSizeHistogram([]int{10, -5}); !errors.Is(err, ErrNegativeBucket) {
+		t.Errorf("negative edge: err = %v, want ErrNegativeBucket", err)
+	}
+}
@@ -0,0 +1,86 @@
+package gormkeyvalue
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidSyncToken = errors.New("invalid sync token")
+
+type syncCheckpoint struct {
+	updatedAt time.Time
+	id        uint64
+}
+
+func (c syncCheckpoint) encode() string {
+	raw := strconv.FormatInt(c.updatedAt.UnixNano(), 10) + ":" + strconv.FormatUint(c.id, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeSyncToken(token string) (syncCheckpoint, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return syncCheckpoint{}, ErrInvalidSyncToken
+	}
+
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return syncCheckpoint{}, ErrInvalidSyncToken
+	}
+
+	unixNano, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return syncCheckpoint{}, ErrInvalidSyncToken
+	}
+	entryID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return syncCheckpoint{}, ErrInvalidSyncToken
+	}
+	return syncCheckpoint{updatedAt: time.Unix(0, unixNano), id: entryID}, nil
+}
+
+// SyncSince returns up to limit entries changed after the checkpoint in token,
+// ordered by (updated_at, id), and the token to resume from. An empty token starts
+// from the beginning. When nothing changed the same token is returned.
+// Deleted entries are not reported.
+// Entries written within DBConfig.SyncSafetyWindowMS are left for a later call, as a
+// transaction may still commit rows stamped before them. A write that commits later than
+// that after its updated_at is missed for good: the window is the limit of the guarantee
+func (db *dbHandler) SyncSince(token string, limit int) ([]Entry, string, error) {
+	limit, err := normalizeLimit(limit)
+	if err != nil {
+		return nil, "", err
+	}
+
+	tx := db.gorm.Model(&Entry{})
+	if db.cfg.SyncSafetyWindowMS > 0 {
+		window := time.Duration(db.cfg.SyncSafetyWindowMS) * time.Millisecond
+		tx = tx.Where("updated_at <= ?", db.gorm.NowFunc().Add(-window))
+	}
+	if token != "" {
+		checkpoint, err := decodeSyncToken(token)
+		if err != nil {
+			return nil, "", err
+		}
+		tx = tx.Where(
+			"updated_at > ? OR (updated_at = ? AND id > ?)",
+			checkpoint.updatedAt, checkpoint.updatedAt, checkpoint.id,
+		)
+	}
+
+	entrys := []Entry{}
+	if err := tx.Order("updated_at ASC, id ASC").Limit(limit).Find(&entrys).Error; err != nil {
+		return nil, "", fmt.Errorf("sync since: %w", err)
+	}
+
+	if len(entrys) == 0 {
+		return entrys, token, nil
+	}
+
+	last := entrys[len(entrys)-1]
+	return entrys, syncCheckpoint{updatedAt: last.UpdatedAt, id: last.ID}.encode(), nil
+}
@@ -0,0 +1,27 @@
+package gormkeyvalue
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSyncSinceLeavesOutTheSafetyWindow(t *testing.T) {
+	m, recorder := NewWithRecorder()
+	db := m.(*dbHandler)
+
+	if _, _, err := m.SyncSince("", 10); err != nil {
+		t.Fatalf("sync since: %v", err)
+	}
+	if sql := recorder.Last(); strings.Contains(sql, "updated_at <=") {
+		t.Errorf("statement %q has a window while it is off", sql)
+	}
+
+	db.cfg.SyncSafetyWindowMS = 5000
+	token := syncCheckpoint{id: 7}.encode()
+	if _, _, err := m.SyncSince(token, 10); err != nil {
+		t.Fatalf("sync since: %v", err)
+	}
+	if sql := recorder.Last(); !strings.Contains(sql, "WHERE updated_at <=") || !strings.Contains(sql, "id > 7") {
+		t.Errorf("statement %q lacks the safety window or the checkpoint", sql)
+	}
+}
@@ -0,0 +1,90 @@
+package gormkeyvalue
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+var ErrEmptyTag = errors.New("tag is empty")
+
+// tagsArrayExpr evaluates to the stored tags as a JSON array, also for rows
+// without tags, where the column is NULL or JSON null
+const tagsArrayExpr = "CASE WHEN tags IS NULL OR JSON_TYPE(tags) <> 'ARRAY' THEN JSON_ARRAY() ELSE tags END"
+
+func (db *dbHandler) GetEntriesByTag(tag string) ([]Entry, error) {
+	entrys := []Entry{}
+	err := db.gorm.Where("JSON_CONTAINS(tags, JSON_QUOTE(?))", tag).Order("id ASC").Find(&entrys).Error
+	if err != nil {
+		return nil, fmt.Errorf("get entries by tag: %w", err)
+	}
+	return entrys, nil
+}
+
+// AddTag adds tag to the entry unless it already has it
+func (db *dbHandler) AddTag(key, tag string) error {
+	if key == "" {
+		return ErrEmptyKey
+	}
+	if tag == "" {
+		return ErrEmptyTag
+	}
+
+	result := db.gorm.Model(&Entry{}).
+		Where("`key` = ?", key).
+		Where("NOT JSON_CONTAINS("+tagsArrayExpr+", JSON_QUOTE(?))", tag).
+		Updates(map[string]interface{}{
+			"tags":       gorm.Expr("JSON_ARRAY_APPEND("+tagsArrayExpr+", '$', ?)", tag),
+			"updated_at": db.gorm.NowFunc(),
+		})
+	if result.Error != nil {
+		return fmt.Errorf("add tag: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return db.requireEntry(key, "add tag")
+	}
+
+	db.fireSaved(key)
+	return nil
+}
+
+// RemoveTag removes tag from the entry, doing nothing when it doesn't have it
+func (db *dbHandler) RemoveTag(key, tag string) error {
+	if key == "" {
+		return ErrEmptyKey
+	}
+	if tag == "" {
+		return ErrEmptyTag
+	}
+
+	// JSON_SEARCH matches like LIKE, so % and _ in the tag are escaped
+	result := db.gorm.Model(&Entry{}).
+		Where("`key` = ?", key).
+		Where("JSON_CONTAINS(tags, JSON_QUOTE(?))", tag).
+		Updates(map[string]interface{}{
+			"tags":       gorm.Expr("JSON_REMOVE(tags, JSON_UNQUOTE(JSON_SEARCH(tags, 'one', ?, ?)))", EscapeLike(tag), likeEscape),
+			"updated_at": db.gorm.NowFunc(),
+		})
+	if result.Error != nil {
+		return fmt.Errorf("remove tag: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return db.requireEntry(key, "remove tag")
+	}
+
+	db.fireSaved(key)
+	return nil
+}
+
+// requireEntry tells an untouched existing entry from a missing one
+func (db *dbHandler) requireEntry(key, op string) error {
+	exists, err := db.IsEntryExists(Entry{Key: key})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if !exists {
+		return ErrEntryNotFound
+	}
+	return nil
+}
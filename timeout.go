@@ -0,0 +1,68 @@
+package gormkeyvalue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	queryTimeoutCancelKey = "gormkeyvalue:query_timeout_cancel"
+	timeoutStartName      = "gormkeyvalue:timeout_start"
+	timeoutFinishName     = "gormkeyvalue:timeout_finish"
+)
+
+type noQueryTimeoutKey struct{}
+
+// withoutQueryTimeout exempts the statements of tx from the default query timeout,
+// for migrations and maintenance DDL which may run much longer than any query
+func withoutQueryTimeout(tx *gorm.DB) *gorm.DB {
+	return tx.WithContext(context.WithValue(tx.Statement.Context, noQueryTimeoutKey{}, true))
+}
+
+// registerQueryTimeout gives every statement without a deadline of its own
+// a context that expires after timeout
+func registerQueryTimeout(conn *gorm.DB, timeout time.Duration) error {
+	start := func(tx *gorm.DB) {
+		if _, ok := tx.Statement.Context.Deadline(); ok {
+			return
+		}
+		if tx.Statement.Context.Value(noQueryTimeoutKey{}) != nil {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(tx.Statement.Context, timeout)
+		tx.Statement.Context = ctx
+		tx.InstanceSet(queryTimeoutCancelKey, cancel)
+	}
+	finish := func(tx *gorm.DB) {
+		if cancel, ok := tx.InstanceGet(queryTimeoutCancelKey); ok {
+			cancel.(context.CancelFunc)()
+		}
+	}
+
+	callbacks := conn.Callback()
+	registrations := []func() error{
+		func() error { return callbacks.Create().Before("*").Register(timeoutStartName, start) },
+		func() error { return callbacks.Create().After("*").Register(timeoutFinishName, finish) },
+		func() error { return callbacks.Query().Before("*").Register(timeoutStartName, start) },
+		func() error { return callbacks.Query().After("*").Register(timeoutFinishName, finish) },
+		func() error { return callbacks.Update().Before("*").Register(timeoutStartName, start) },
+		func() error { return callbacks.Update().After("*").Register(timeoutFinishName, finish) },
+		func() error { return callbacks.Delete().Before("*").Register(timeoutStartName, start) },
+		func() error { return callbacks.Delete().After("*").Register(timeoutFinishName, finish) },
+		func() error { return callbacks.Raw().Before("*").Register(timeoutStartName, start) },
+		func() error { return callbacks.Raw().After("*").Register(timeoutFinishName, finish) },
+		// rows of a row statement are read after its callbacks ran, so there is no
+		// finish: the context is left to expire, which also releases its timer
+		func() error { return callbacks.Row().Before("*").Register(timeoutStartName, start) },
+	}
+	for _, register := range registrations {
+		if err := register(); err != nil {
+			return fmt.Errorf("register query timeout: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package gormkeyvalue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// newSlowStore returns a recorder store whose statements block until their context
+// is done, reporting whether they ran with a deadline
+func newSlowStore(t *testing.T, timeout time.Duration) (*dbHandler, *bool) {
+	t.Helper()
+
+	m, _ := NewWithRecorder()
+	db := m.(*dbHandler)
+	if err := registerQueryTimeout(db.gorm, timeout); err != nil {
+		t.Fatalf("register query timeout: %v", err)
+	}
+
+	var hadDeadline bool
+	slow := func(tx *gorm.DB) {
+		ctx := tx.Statement.Context
+		_, hadDeadline = ctx.Deadline()
+		if !hadDeadline {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			tx.AddError(ctx.Err())
+		case <-time.After(time.Second):
+		}
+	}
+
+	callbacks := db.gorm.Callback()
+	if err := callbacks.Query().Before("gorm:query").Register("test:slow", slow); err != nil {
+		t.Fatalf("register slow query: %v", err)
+	}
+	if err := callbacks.Raw().Before("gorm:raw").Register("test:slow", slow); err != nil {
+		t.Fatalf("register slow raw: %v", err)
+	}
+	return db, &hadDeadline
+}
+
+func TestQueryTimeoutCancelsSlowQuery(t *testing.T) {
+	db, _ := newSlowStore(t, 20*time.Millisecond)
+
+	begin := time.Now()
+	_, err := db.GetEntry("key")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(begin); elapsed > 500*time.Millisecond {
+		t.Errorf("query returned after %s, the timeout is 20ms", elapsed)
+	}
+}
+
+func TestQueryTimeoutKeepsCallerDeadline(t *testing.T) {
+	db, hadDeadline := newSlowStore(t, time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err := db.gorm.WithContext(ctx).Find(&[]Entry{}).Error
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if !*hadDeadline {
+		t.Error("query ran without the caller's deadline")
+	}
+}
+
+func TestQueryTimeoutExemptsMaintenance(t *testing.T) {
+	db, hadDeadline := newSlowStore(t, 20*time.Millisecond)
+
+	// reset by the slow callback, so a statement that never ran fails the test
+	*hadDeadline = true
+	if err := db.migrationDB().Find(&[]Entry{}).Error; err != nil {
+		t.Errorf("migration query: %v", err)
+	}
+	if *hadDeadline {
+		t.Error("migration query ran with the default query timeout")
+	}
+
+	*hadDeadline = true
+	if err := db.Optimize(); err != nil {
+		t.Errorf("optimize: %v", err)
+	}
+	if *hadDeadline {
+		t.Error("optimize ran with the default query timeout")
+	}
+}
@@ -0,0 +1,86 @@
+package gormkeyvalue
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"gorm.io/gorm"
+)
+
+const valueSchemaURL = "value.schema.json"
+
+var ErrSchemaValidation = errors.New("value does not match schema")
+
+type valueValidator struct {
+	schema atomic.Pointer[jsonschema.Schema]
+}
+
+func (v *valueValidator) validate(value []byte) error {
+	s := v.schema.Load()
+	if s == nil {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return fmt.Errorf("%w: %v", ErrSchemaValidation, err)
+	}
+	if err := s.Validate(doc); err != nil {
+		return fmt.Errorf("%w: %v", ErrSchemaValidation, err)
+	}
+	return nil
+}
+
+func (v *valueValidator) enabled() bool {
+	return v.schema.Load() != nil
+}
+
+// withValidatedWrite runs write, which computes the new value of key in SQL, and with
+// a value schema set checks the stored result in the same transaction, so a mismatch
+// is rolled back instead of bypassing the schema
+func (db *dbHandler) withValidatedWrite(key string, write func(tx *gorm.DB) error) error {
+	if !db.validator.enabled() {
+		return write(db.gorm)
+	}
+
+	return db.gorm.Transaction(func(tx *gorm.DB) error {
+		if err := write(tx); err != nil {
+			return err
+		}
+
+		var stored Entry
+		if err := tx.Model(&Entry{}).Select("value").Where("`key` = ?", key).Take(&stored).Error; err != nil {
+			return fmt.Errorf("read written value: %w", err)
+		}
+		return db.validator.validate(stored.Value)
+	})
+}
+
+// SetValueSchema compiles a JSON Schema that every saved value must match.
+// An empty schema turns the validation off
+func (db *dbHandler) SetValueSchema(schema []byte) error {
+	if len(schema) == 0 {
+		db.validator.schema.Store(nil)
+		return nil
+	}
+
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(valueSchemaURL, bytes.NewReader(schema)); err != nil {
+		return fmt.Errorf("add value schema: %w", err)
+	}
+
+	compiled, err := compiler.Compile(valueSchemaURL)
+	if err != nil {
+		return fmt.Errorf("compile value schema: %w", err)
+	}
+
+	db.validator.schema.Store(compiled)
+	return nil
+}
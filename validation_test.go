@@ -0,0 +1,61 @@
+package gormkeyvalue
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestSQLComputedWritesAreValidated(t *testing.T) {
+	m, recorder := NewWithRecorder()
+	db := m.(*dbHandler)
+	db.gorm.ConnPool = dryRunTxPool{ConnPool: db.gorm.ConnPool}
+	db.gorm.Statement.ConnPool = db.gorm.ConnPool
+
+	// reads find the value the SQL would have written
+	written := []byte(`{"n":1}`)
+	err := db.gorm.Callback().Query().After("gorm:query").Register("test:written", func(tx *gorm.DB) {
+		if e, ok := tx.Statement.Dest.(*Entry); ok {
+			e.Value = written
+		}
+	})
+	if err != nil {
+		t.Fatalf("register written callback: %v", err)
+	}
+	err = db.gorm.Callback().Update().After("gorm:update").Register("test:updated", func(tx *gorm.DB) {
+		tx.RowsAffected = 1
+	})
+	if err != nil {
+		t.Fatalf("register updated callback: %v", err)
+	}
+
+	if err := m.AppendToJSONArray("k", []byte(`1`)); err != nil {
+		t.Fatalf("append without a schema: %v", err)
+	}
+	for _, sql := range recorder.Statements() {
+		if strings.HasPrefix(sql, "SELECT") {
+			t.Errorf("read %q back without a schema", sql)
+		}
+	}
+
+	if err := m.SetValueSchema([]byte(`{"type": "array"}`)); err != nil {
+		t.Fatalf("set value schema: %v", err)
+	}
+	tests := []struct {
+		name  string
+		write func() error
+	}{
+		{"MergePatchValue", func() error { return m.MergePatchValue("k", []byte(`{"n":2}`)) }},
+		{"AppendToJSONArray", func() error { return m.AppendToJSONArray("k", []byte(`1`)) }},
+		{"IncrementEntry", func() error { _, err := m.IncrementEntry("k", 1); return err }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.write(); !errors.Is(err, ErrSchemaValidation) {
+				t.Errorf("err = %v, want ErrSchemaValidation", err)
+			}
+		})
+	}
+}
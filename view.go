@@ -0,0 +1,86 @@
+package gormkeyvalue
+
+import (
+	"fmt"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// prefixViews caches the WithPrefix views of a store,
+// so each prefix sets up its gorm instance and statement cache once
+type prefixViews struct {
+	mu       sync.Mutex
+	byPrefix map[string]*dbHandler
+}
+
+func newPrefixViews() *prefixViews {
+	return &prefixViews{byPrefix: map[string]*dbHandler{}}
+}
+
+// close releases the prepared statements of the views, it is called by the parent's Close
+func (v *prefixViews) close() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for _, view := range v.byPrefix {
+		if stmtDB, ok := view.gorm.ConnPool.(*gorm.PreparedStmtDB); ok {
+			stmtDB.Close()
+		}
+	}
+}
+
+// WithPrefix returns a store on the same connection pool bound to another table prefix.
+// Calls with the same prefix return the same view. The view never migrates:
+// call RepairSchema on it to create a missing table.
+// Its Close leaves the connection, hooks and event handlers of db open
+func (db *dbHandler) WithPrefix(prefix string) (Memory, error) {
+	db.prefixViews.mu.Lock()
+	defer db.prefixViews.mu.Unlock()
+
+	if view, ok := db.prefixViews.byPrefix[prefix]; ok {
+		return view, nil
+	}
+
+	cfg := db.cfg
+	cfg.TablePrefix = prefix
+
+	gormConn, err := openGormView(db.gorm, db.conn, cfg, db.queryHooks)
+	if err != nil {
+		return nil, fmt.Errorf("with prefix: %w", err)
+	}
+
+	view := *db
+	view.cfg = cfg
+	view.gorm = gormConn
+	view.tablesPrefix = getTablePrefix(cfg)
+	view.ownsConn = false
+	view.isView = true
+	// shared by every caller, closed with db
+	view.ownsStmtCache = false
+	if err := view.applyModelOptions(); err != nil {
+		return nil, fmt.Errorf("with prefix: %w", err)
+	}
+
+	db.prefixViews.byPrefix[prefix] = &view
+	return &view, nil
+}
+
+// WithSession returns a store whose queries run in the given gorm session,
+// e.g. &gorm.Session{PrepareStmt: true} or &gorm.Session{DryRun: true}.
+// Its Close leaves the connection, hooks and event handlers of db open
+func (db *dbHandler) WithSession(session *gorm.Session) Memory {
+	view := *db
+	view.gorm = db.gorm.Session(session)
+	view.ownsConn = false
+	view.isView = true
+	view.ownsStmtCache = false
+	return &view
+}
+
+// GormDB is an escape hatch for queries the package doesn't offer, use it at your own risk.
+// It returns a new session: don't register callbacks or plugins on it,
+// they are shared with the store
+func (db *dbHandler) GormDB() *gorm.DB {
+	return db.gorm.Session(&gorm.Session{NewDB: true})
+}
@@ -0,0 +1,64 @@
+package gormkeyvalue
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestWithPrefixReusesViews(t *testing.T) {
+	m, recorder := NewWithRecorder()
+
+	first, err := m.WithPrefix("tenant")
+	if err != nil {
+		t.Fatalf("with prefix: %v", err)
+	}
+	again, err := m.WithPrefix("tenant")
+	if err != nil {
+		t.Fatalf("with prefix: %v", err)
+	}
+	if first != again {
+		t.Error("a second call with the same prefix built another view")
+	}
+
+	if got, want := first.ManagedTables(), []string{"tenant_entries"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("view tables = %v, want %v", got, want)
+	}
+	if got, want := m.ManagedTables(), []string{"entries"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parent tables = %v, want %v", got, want)
+	}
+
+	// the view keeps the dry run and logger of its parent
+	if err := first.SaveKV("k", []byte(`1`)); err != nil {
+		t.Fatalf("save kv: %v", err)
+	}
+	if sql := recorder.Last(); !strings.Contains(sql, "INSERT INTO `tenant_entries`") {
+		t.Errorf("view statement %q doesn't write the prefixed table", sql)
+	}
+}
+
+func TestViewCloseLeavesParentOpen(t *testing.T) {
+	m, _ := NewWithRecorder()
+	db := m.(*dbHandler)
+
+	view, err := m.WithPrefix("tenant")
+	if err != nil {
+		t.Fatalf("with prefix: %v", err)
+	}
+	if err := view.Close(); err != nil {
+		t.Fatalf("close prefix view: %v", err)
+	}
+	if err := m.WithSession(&gorm.Session{}).Close(); err != nil {
+		t.Fatalf("close session view: %v", err)
+	}
+
+	if db.hooks.events.closed {
+		t.Error("closing a view closed the parent's event dispatchers")
+	}
+	// without a server Ping fails anyway, but not for a closed pool
+	if err := db.conn.Ping(); err != nil && strings.Contains(err.Error(), "database is closed") {
+		t.Error("closing a view closed the parent's connection")
+	}
+}